@@ -26,6 +26,7 @@ func Command() {
 	registerCompile(app)
 	registerExec(app)
 	registerDaemon(app)
+	registerEncrypt(app)
 	service.Register(app)
 
 	kingpin.Version(version)
@@ -29,6 +29,7 @@ type compileCommand struct {
 	Source  *os.File
 	Environ map[string]string
 	Secrets map[string]string
+	Files   bool
 }
 
 func (c *compileCommand) run(*kingpin.ParseContext) error {
@@ -80,18 +81,22 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
-		Pipeline: resource,
-		Manifest: manifest,
-		Build:    c.Build,
-		Netrc:    c.Netrc,
-		Repo:     c.Repo,
-		Stage:    c.Stage,
-		System:   c.System,
-		Environ:  c.Environ,
-		Secret:   secret.StaticVars(c.Secrets),
-		Root:     c.Root,
+		Pipeline:    resource,
+		Manifest:    manifest,
+		Build:       c.Build,
+		Netrc:       c.Netrc,
+		Repo:        c.Repo,
+		Stage:       c.Stage,
+		System:      c.System,
+		Environ:     c.Environ,
+		Secret:      secret.StaticVars(c.Secrets),
+		Root:        c.Root,
+		SecretFiles: c.Files,
+	}
+	spec, err := comp.Compile(nocontext)
+	if err != nil {
+		return err
 	}
-	spec := comp.Compile(nocontext)
 
 	// encode the pipeline in json format and print to the
 	// console for inspection.
@@ -103,6 +108,7 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 
 func registerCompile(app *kingpin.Application) {
 	c := new(compileCommand)
+	c.Secrets = map[string]string{}
 
 	cmd := app.Command("compile", "compile the yaml file").
 		Action(c.run)
@@ -115,6 +121,12 @@ func registerCompile(app *kingpin.Application) {
 		Default(".drone.yml").
 		FileVar(&c.Source)
 
+	cmd.Flag("secret", "secret provided to the pipeline, in the format name=value").
+		StringMapVar(&c.Secrets)
+
+	cmd.Flag("secret-files", "provide masked secrets to the pipeline as files, instead of environment variables").
+		BoolVar(&c.Files)
+
 	// shared pipeline flags
 	c.Flags = internal.ParseFlags(cmd)
 }
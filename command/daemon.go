@@ -6,10 +6,12 @@ package command
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/drone-runners/drone-runner-exec/daemon"
 
-	"github.com/drone/signal"
 	"github.com/joho/godotenv"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -32,13 +34,30 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 	defer cancel()
 
 	// listen for termination signals to gracefully shutdown
-	// the runner daemon.
-	ctx = signal.WithContextFunc(ctx, func() {
-		println("received signal, terminating process")
-		cancel()
-	})
+	// the runner daemon. The first signal drains the runner,
+	// and the second signal cancels the running stages.
+	drain := make(chan struct{})
+	go func() {
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(c)
 
-	return daemon.Run(ctx, config)
+		select {
+		case <-ctx.Done():
+			return
+		case <-c:
+			println("received signal, draining the runner")
+			close(drain)
+		}
+		select {
+		case <-ctx.Done():
+		case <-c:
+			println("received signal, terminating process")
+			cancel()
+		}
+	}()
+
+	return daemon.Run(ctx, drain, config)
 }
 
 func registerDaemon(app *kingpin.Application) {
@@ -0,0 +1,121 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/runtime"
+)
+
+// debugger is an engine that opens an interactive shell when a
+// pipeline step fails, once the retry policy is exhausted. The
+// step remains failed, and the pipeline continues if the shell
+// exits successfully, and is cancelled otherwise.
+type debugger struct {
+	engine.Engine
+
+	cancel context.CancelFunc
+
+	mu       sync.Mutex // serializes the debug shells
+	guard    sync.Mutex // guards the fields below
+	active   bool
+	aborted  bool
+	attempts map[string]int
+}
+
+// Run runs the pipeline step, and opens an interactive shell in
+// the step environment if the step fails or exceeds its timeout.
+func (d *debugger) Run(ctx context.Context, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+	state, err := d.Engine.Run(ctx, spec, step, output)
+	attempt := d.attempt(step.Name)
+	// a step that exceeds its timeout is killed, and has no
+	// exit code, but is debugged as a failed step.
+	timeout := err == engine.ErrTimeout
+	if step.Detach || (!timeout && (state == nil || state.ExitCode == 0)) {
+		return state, err
+	}
+	// the shell is not opened if the step is executed again.
+	if runtime.WillRetry(step, attempt, state, err) {
+		return state, err
+	}
+
+	// concurrent steps that fail are debugged one at a time,
+	// since the shell reads from the terminal.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ctx.Err() != nil {
+		return state, err
+	}
+
+	if timeout {
+		fmt.Fprintf(os.Stderr, "\nstep %s failed, timeout exceeded\n", step.Name)
+	} else {
+		fmt.Fprintf(os.Stderr, "\nstep %s failed with exit code %d\n", step.Name, state.ExitCode)
+	}
+	fmt.Fprintf(os.Stderr, "opening a debug shell in %s\n", step.WorkingDir)
+	fmt.Fprintln(os.Stderr, "exit 0 to continue the pipeline, or exit non-zero to abort")
+
+	d.setActive(true)
+	result, shellErr := engine.Shell(ctx, spec, step)
+	d.setActive(false)
+
+	switch {
+	case shellErr != nil:
+		fmt.Fprintf(os.Stderr, "cannot open the debug shell: %s\n", shellErr)
+	case result.ExitCode != 0:
+		fmt.Fprintln(os.Stderr, "aborting the pipeline")
+		d.abort()
+	default:
+		fmt.Fprintln(os.Stderr, "continuing the pipeline")
+	}
+	return state, err
+}
+
+// helper function increments and returns the number of times
+// the named step is executed.
+func (d *debugger) attempt(name string) int {
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	if d.attempts == nil {
+		d.attempts = map[string]int{}
+	}
+	d.attempts[name]++
+	return d.attempts[name]
+}
+
+// helper function cancels the pipeline.
+func (d *debugger) abort() {
+	d.guard.Lock()
+	d.aborted = true
+	d.guard.Unlock()
+	d.cancel()
+}
+
+// isAborted returns true if the pipeline was cancelled from a
+// debug shell.
+func (d *debugger) isAborted() bool {
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	return d.aborted
+}
+
+// debugging returns true if a debug shell is open.
+func (d *debugger) debugging() bool {
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	return d.active
+}
+
+func (d *debugger) setActive(active bool) {
+	d.guard.Lock()
+	d.active = active
+	d.guard.Unlock()
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone-runners/drone-runner-exec/internal/secrets"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type encryptCommand struct {
+	Key    string
+	Source *os.File
+}
+
+func (c *encryptCommand) run(*kingpin.ParseContext) error {
+	raw, err := ioutil.ReadAll(c.Source)
+	if err != nil {
+		return err
+	}
+
+	// the source file is a json object that maps each secret
+	// name to the secret value.
+	in := map[string]string{}
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return err
+	}
+
+	out, err := secrets.Encrypt(in, c.Key)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(out, '\n'))
+	return err
+}
+
+func registerEncrypt(app *kingpin.Application) {
+	c := new(encryptCommand)
+
+	cmd := app.Command("encrypt", "encrypts a json file of secrets for the encrypted file secret provider").
+		Action(c.run)
+
+	cmd.Arg("source", "json file of secret names and values").
+		Required().
+		FileVar(&c.Source)
+
+	cmd.Flag("key", "32 byte encryption key").
+		Envar("DRONE_SECRET_ENCRYPTED_KEY").
+		Required().
+		StringVar(&c.Key)
+}
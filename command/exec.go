@@ -9,13 +9,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/drone-runners/drone-runner-exec/command/internal"
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/compiler"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
 	"github.com/drone-runners/drone-runner-exec/runtime"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/envsubst"
@@ -24,7 +27,6 @@ import (
 	"github.com/drone/runner-go/pipeline"
 	"github.com/drone/runner-go/pipeline/console"
 	"github.com/drone/runner-go/secret"
-	"github.com/drone/signal"
 
 	"github.com/mattn/go-isatty"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -33,12 +35,24 @@ import (
 type execCommand struct {
 	*internal.Flags
 
-	Root    string
-	Source  *os.File
-	Environ map[string]string
-	Secrets map[string]string
-	Pretty  bool
-	Procs   int64
+	Root      string
+	Source    *os.File
+	Environ   map[string]string
+	Secrets   map[string]string
+	Pretty    bool
+	Procs     int64
+	Grace     time.Duration
+	User      string
+	Group     string
+	Cgroup    string
+	Sandbox   bool
+	Files     bool
+	Keep      string
+	Artifacts string
+	Include   []string
+	Exclude   []string
+	Resume    string
+	Debug     bool
 }
 
 func (c *execCommand) run(*kingpin.ParseContext) error {
@@ -90,18 +104,36 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
-		Pipeline: resource,
-		Manifest: manifest,
-		Build:    c.Build,
-		Netrc:    c.Netrc,
-		Repo:     c.Repo,
-		Stage:    c.Stage,
-		System:   c.System,
-		Environ:  c.Environ,
-		Secret:   secret.StaticVars(c.Secrets),
-		Root:     c.Root,
-	}
-	spec := comp.Compile(nocontext)
+		Pipeline:    resource,
+		Manifest:    manifest,
+		Build:       c.Build,
+		Netrc:       c.Netrc,
+		Repo:        c.Repo,
+		Stage:       c.Stage,
+		System:      c.System,
+		Environ:     c.Environ,
+		Secret:      secret.StaticVars(c.Secrets),
+		Root:        c.Root,
+		User:        c.User,
+		Group:       c.Group,
+		Sandbox:     c.Sandbox,
+		SecretFiles: c.Files,
+
+		// configures the subset of pipeline steps to execute,
+		// so that the secrets of the other steps are not
+		// required.
+		Select: func(spec *engine.Spec) error {
+			return internal.Select(spec, compiler.Expand(resource), internal.Selection{
+				Include:    c.Include,
+				Exclude:    c.Exclude,
+				ResumeFrom: c.Resume,
+			})
+		},
+	}
+	spec, err := comp.Compile(nocontext)
+	if err != nil {
+		return err
+	}
 
 	// create a step object for each pipeline step.
 	for _, step := range spec.Steps {
@@ -122,28 +154,74 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 	ctx, cancel := context.WithTimeout(nocontext, timeout)
 	defer cancel()
 
-	// listen for operating system signals and cancel execution
-	// when received.
-	ctx = signal.WithContextFunc(ctx, func() {
-		println("received signal, terminating process")
-		cancel()
+	var engine engine.Engine = engine.New(engine.Opts{
+		GracePeriod: c.Grace,
+		Cgroup:      c.Cgroup,
 	})
 
+	// in debug mode, an interactive shell is opened when a
+	// pipeline step fails.
+	var debug *debugger
+	if c.Debug {
+		debug = &debugger{Engine: engine, cancel: cancel}
+		engine = debug
+	}
+
+	// listen for operating system signals and cancel execution
+	// when received. Signals are ignored while the debug shell
+	// is open, since the signals are intended for the shell.
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if debug != nil && debug.debugging() {
+					continue
+				}
+				println("received signal, terminating process")
+				cancel()
+				return
+			}
+		}
+	}()
+
 	state := &pipeline.State{
 		Build:  c.Build,
 		Stage:  c.Stage,
 		Repo:   c.Repo,
 		System: c.System,
 	}
+	keep, err := runtime.ParseKeep(c.Keep)
+	if err != nil {
+		return err
+	}
+	var store artifact.Store
+	if c.Artifacts != "" {
+		store = artifact.Local(c.Artifacts)
+	}
 	err = runtime.NewExecer(
 		pipeline.NopReporter(),
 		console.New(c.Pretty),
-		engine.New(),
+		engine,
 		c.Procs,
+		keep,
+		store,
 	).Exec(ctx, spec, state)
 	if err != nil {
 		return err
 	}
+	if keep == runtime.KeepAlways || keep == runtime.KeepOnFailure && state.Failed() {
+		fmt.Printf("pipeline workspace kept at %s\n", spec.Root)
+	}
+	// the pipeline is cancelled when the debug shell exits
+	// non-zero, in which case the pipeline status is killed.
+	if debug != nil && debug.isAborted() {
+		os.Exit(1)
+	}
 	switch state.Stage.Status {
 	case drone.StatusError, drone.StatusFailing:
 		os.Exit(1)
@@ -153,6 +231,7 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 
 func registerExec(app *kingpin.Application) {
 	c := new(execCommand)
+	c.Secrets = map[string]string{}
 
 	cmd := app.Command("exec", "executes a pipeline").
 		Action(c.run)
@@ -174,6 +253,52 @@ func registerExec(app *kingpin.Application) {
 			),
 		).BoolVar(&c.Pretty)
 
+	cmd.Flag("grace-period", "time allowed for a cancelled step to exit before it is killed").
+		Default("10s").
+		DurationVar(&c.Grace)
+
+	cmd.Flag("user", "operating system user used to execute the pipeline").
+		Default("").
+		StringVar(&c.User)
+
+	cmd.Flag("group", "operating system group used to execute the pipeline").
+		Default("").
+		StringVar(&c.Group)
+
+	cmd.Flag("cgroup", "cgroup v2 path used to enforce the pipeline resource limits").
+		Default("").
+		StringVar(&c.Cgroup)
+
+	cmd.Flag("sandbox", "execute the pipeline in the sandbox, with read-only access to the host").
+		BoolVar(&c.Sandbox)
+
+	cmd.Flag("secret", "secret provided to the pipeline, in the format name=value").
+		StringMapVar(&c.Secrets)
+
+	cmd.Flag("secret-files", "provide masked secrets to the pipeline as files, instead of environment variables").
+		BoolVar(&c.Files)
+
+	cmd.Flag("artifacts-dir", "directory where the pipeline artifacts are uploaded").
+		Default("").
+		StringVar(&c.Artifacts)
+
+	cmd.Flag("keep-workspace", "keep the pipeline workspace on failure, or always").
+		Default("never").
+		EnumVar(&c.Keep, "never", "failure", "always")
+
+	cmd.Flag("include", "execute the named step, and the steps it depends on").
+		StringsVar(&c.Include)
+
+	cmd.Flag("exclude", "do not execute the named step").
+		StringsVar(&c.Exclude)
+
+	cmd.Flag("resume-from", "resume execution from the named step").
+		Default("").
+		StringVar(&c.Resume)
+
+	cmd.Flag("debug", "open an interactive shell in the step environment when a step fails").
+		BoolVar(&c.Debug)
+
 	// shared pipeline flags
 	c.Flags = internal.ParseFlags(cmd)
 }
@@ -0,0 +1,116 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+)
+
+// Selection defines the subset of pipeline steps to execute.
+type Selection struct {
+	// Include defines the steps to execute, including the
+	// steps they depend on. All steps are included if empty.
+	Include []string
+
+	// Exclude defines the steps that are not executed.
+	Exclude []string
+
+	// ResumeFrom defines the step from which execution is
+	// resumed. Steps defined before this step are assumed to
+	// be complete and are not executed.
+	ResumeFrom string
+}
+
+// Select configures the unselected pipeline steps to never run.
+// The dependencies of a step are the dependencies defined in the
+// pipeline steps, and not the implicit dependencies of a serial
+// pipeline. The implicit steps, such as the clone step, are
+// selected unless excluded. An error is returned if a selected
+// step depends on an excluded step, or if a step does not exist.
+func Select(spec *engine.Spec, steps []*resource.Step, sel Selection) error {
+	index := map[string]int{}
+	for i, step := range spec.Steps {
+		index[step.Name] = i
+	}
+	deps := map[string][]string{}
+	for _, step := range steps {
+		deps[step.Name] = step.DependsOn
+	}
+
+	names := append(append([]string{}, sel.Include...), sel.Exclude...)
+	if sel.ResumeFrom != "" {
+		names = append(names, sel.ResumeFrom)
+	}
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("cannot select step %s: step does not exist", name)
+		}
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range sel.Exclude {
+		excluded[name] = true
+	}
+
+	// the included steps, and the steps they depend on, are
+	// selected. All steps are selected if none are included.
+	// The implicit steps are not defined in the pipeline, and
+	// are always selected.
+	selected := map[string]bool{}
+	for _, step := range spec.Steps {
+		if _, ok := deps[step.Name]; !ok {
+			selected[step.Name] = true
+		}
+	}
+	var include func(name string)
+	include = func(name string) {
+		if selected[name] {
+			return
+		}
+		selected[name] = true
+		for _, dep := range deps[name] {
+			include(dep)
+		}
+	}
+	if len(sel.Include) == 0 {
+		for _, step := range spec.Steps {
+			selected[step.Name] = true
+		}
+	}
+	for _, name := range sel.Include {
+		include(name)
+	}
+
+	// steps defined before the resumed step are complete.
+	if sel.ResumeFrom != "" {
+		for _, step := range spec.Steps[:index[sel.ResumeFrom]] {
+			delete(selected, step.Name)
+		}
+	}
+	for name := range excluded {
+		delete(selected, name)
+	}
+
+	for _, step := range spec.Steps {
+		if !selected[step.Name] {
+			continue
+		}
+		for _, dep := range deps[step.Name] {
+			if excluded[dep] {
+				return fmt.Errorf("cannot select step %s: step depends on excluded step %s", step.Name, dep)
+			}
+		}
+	}
+
+	for _, step := range spec.Steps {
+		if !selected[step.Name] {
+			step.RunPolicy = engine.RunNever
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		sel  Selection
+		want []string
+		err  bool
+	}{
+		{
+			sel:  Selection{},
+			want: []string{"clone", "build", "vet", "test", "deploy", "artifacts"},
+		},
+		{
+			sel:  Selection{Include: []string{"test"}},
+			want: []string{"clone", "build", "test", "artifacts"},
+		},
+		{
+			sel:  Selection{Include: []string{"test", "vet"}},
+			want: []string{"clone", "build", "vet", "test", "artifacts"},
+		},
+		{
+			sel:  Selection{Include: []string{"test"}, Exclude: []string{"clone", "artifacts"}},
+			want: []string{"build", "test"},
+		},
+		{
+			sel:  Selection{Exclude: []string{"clone", "deploy"}},
+			want: []string{"build", "vet", "test", "artifacts"},
+		},
+		{
+			sel:  Selection{ResumeFrom: "vet"},
+			want: []string{"vet", "test", "deploy", "artifacts"},
+		},
+		{
+			sel:  Selection{ResumeFrom: "vet", Exclude: []string{"deploy"}},
+			want: []string{"vet", "test", "artifacts"},
+		},
+		{
+			sel:  Selection{ResumeFrom: "test", Include: []string{"test"}},
+			want: []string{"test", "artifacts"},
+		},
+		{
+			sel: Selection{Exclude: []string{"build"}},
+			err: true,
+		},
+		{
+			sel: Selection{Include: []string{"test"}, Exclude: []string{"build"}},
+			err: true,
+		},
+		{
+			sel: Selection{Include: []string{"lint"}},
+			err: true,
+		},
+		{
+			sel: Selection{ResumeFrom: "lint"},
+			err: true,
+		},
+	}
+
+	for i, test := range tests {
+		spec, pipeline := testSpec()
+		err := Select(spec, pipeline.Steps, test.sel)
+		if test.err {
+			if err == nil {
+				t.Errorf("Want error for selection %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Want no error for selection %d, got %s", i, err)
+			continue
+		}
+		var got []string
+		for _, step := range spec.Steps {
+			if step.RunPolicy != engine.RunNever {
+				got = append(got, step.Name)
+			}
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected steps selected for selection %d", i)
+			t.Log(diff)
+		}
+	}
+}
+
+// This test verifies that the implicit dependencies of a serial
+// pipeline do not prevent a step from being excluded.
+func TestSelect_Serial(t *testing.T) {
+	spec := &engine.Spec{
+		Steps: []*engine.Step{
+			{Name: "build"},
+			{Name: "test", DependsOn: []string{"build"}},
+		},
+	}
+	pipeline := &resource.Pipeline{
+		Steps: []*resource.Step{
+			{Name: "build"},
+			{Name: "test"},
+		},
+	}
+	if err := Select(spec, pipeline.Steps, Selection{Exclude: []string{"build"}}); err != nil {
+		t.Error(err)
+	}
+	if spec.Steps[0].RunPolicy != engine.RunNever {
+		t.Errorf("Want excluded step to never run")
+	}
+}
+
+// helper function returns a compiled pipeline graph and the
+// source pipeline.
+func testSpec() (*engine.Spec, *resource.Pipeline) {
+	pipeline := &resource.Pipeline{
+		Steps: []*resource.Step{
+			{Name: "build"},
+			{Name: "vet", DependsOn: []string{"build"}},
+			{Name: "test", DependsOn: []string{"build"}},
+			{Name: "deploy", DependsOn: []string{"vet", "test"}},
+		},
+	}
+	spec := &engine.Spec{
+		Steps: []*engine.Step{
+			{Name: "clone"},
+			{Name: "build", DependsOn: []string{"clone"}},
+			{Name: "vet", DependsOn: []string{"build"}},
+			{Name: "test", DependsOn: []string{"build"}},
+			{Name: "deploy", DependsOn: []string{"vet", "test"}},
+			{Name: "artifacts", DependsOn: []string{"clone", "build", "vet", "test", "deploy"}},
+		},
+	}
+	return spec, pipeline
+}
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/kelseyhightower/envconfig"
 
 	"github.com/joho/godotenv"
@@ -68,21 +70,88 @@ type Config struct {
 		Path     string            `envconfig:"DRONE_RUNNER_PATH"`
 		Root     string            `envconfig:"DRONE_RUNNER_ROOT"`
 		Symlinks map[string]string `envconfig:"DRONE_RUNNER_SYMLINKS"`
+		Grace    time.Duration     `envconfig:"DRONE_RUNNER_GRACE_PERIOD" default:"10s"`
+		Drain    time.Duration     `envconfig:"DRONE_RUNNER_DRAIN_TIMEOUT" default:"1h"`
+		User     string            `envconfig:"DRONE_RUNNER_USER"`
+		Group    string            `envconfig:"DRONE_RUNNER_GROUP"`
+
+		Keep       string        `envconfig:"DRONE_RUNNER_KEEP_WORKSPACE" default:"never"`
+		KeepTTL    time.Duration `envconfig:"DRONE_RUNNER_KEEP_WORKSPACE_TTL" default:"24h"`
+		KeepBudget BytesSize     `envconfig:"DRONE_RUNNER_KEEP_WORKSPACE_BUDGET"`
 	}
 
 	Limit struct {
-		Repos   []string `envconfig:"DRONE_LIMIT_REPOS"`
-		Events  []string `envconfig:"DRONE_LIMIT_EVENTS"`
-		Trusted bool     `envconfig:"DRONE_LIMIT_TRUSTED"`
+		Repos   []string  `envconfig:"DRONE_LIMIT_REPOS"`
+		Events  []string  `envconfig:"DRONE_LIMIT_EVENTS"`
+		Trusted bool      `envconfig:"DRONE_LIMIT_TRUSTED"`
+		Memory  BytesSize `envconfig:"DRONE_LIMIT_MEMORY"`
+		CPU     float64   `envconfig:"DRONE_LIMIT_CPU"`
+		Pids    int64     `envconfig:"DRONE_LIMIT_PIDS"`
+		Cgroup  string    `envconfig:"DRONE_LIMIT_CGROUP" default:"/sys/fs/cgroup/drone-runner-exec"`
+	}
+
+	Disk struct {
+		MinFree   BytesSize `envconfig:"DRONE_DISK_MIN_FREE"`
+		MinInodes int64     `envconfig:"DRONE_DISK_MIN_INODES"`
+	}
+
+	Artifacts struct {
+		Dir       string `envconfig:"DRONE_ARTIFACTS_DIR"`
+		Endpoint  string `envconfig:"DRONE_ARTIFACTS_S3_ENDPOINT"`
+		Bucket    string `envconfig:"DRONE_ARTIFACTS_S3_BUCKET"`
+		Region    string `envconfig:"DRONE_ARTIFACTS_S3_REGION" default:"us-east-1"`
+		AccessKey string `envconfig:"DRONE_ARTIFACTS_S3_ACCESS_KEY"`
+		SecretKey string `envconfig:"DRONE_ARTIFACTS_S3_SECRET_KEY"`
+		PathStyle bool   `envconfig:"DRONE_ARTIFACTS_S3_PATH_STYLE"`
+	}
+
+	Load struct {
+		MaxLoad           float64       `envconfig:"DRONE_LOAD_MAX_AVERAGE"`
+		MaxMemoryPressure float64       `envconfig:"DRONE_LOAD_MAX_MEMORY_PRESSURE"`
+		MaxCPU            float64       `envconfig:"DRONE_LOAD_MAX_CPU"`
+		Settle            time.Duration `envconfig:"DRONE_LOAD_SETTLE_PERIOD" default:"30s"`
+	}
+
+	Sandbox struct {
+		Enabled bool     `envconfig:"DRONE_SANDBOX_ENABLED"`
+		Repos   []string `envconfig:"DRONE_SANDBOX_EXCLUDE_REPOS"`
+		Trusted bool     `envconfig:"DRONE_SANDBOX_EXCLUDE_TRUSTED"`
 	}
 
 	Secret struct {
 		Endpoint   string `envconfig:"DRONE_SECRET_PLUGIN_ENDPOINT"`
 		Token      string `envconfig:"DRONE_SECRET_PLUGIN_TOKEN"`
 		SkipVerify bool   `envconfig:"DRONE_SECRET_PLUGIN_SKIP_VERIFY"`
+		Files      bool   `envconfig:"DRONE_SECRET_FILES"`
+
+		Dir      string   `envconfig:"DRONE_SECRET_DIR"`
+		DirRepos []string `envconfig:"DRONE_SECRET_DIR_REPOS"`
+
+		EncryptedFile  string   `envconfig:"DRONE_SECRET_ENCRYPTED_FILE"`
+		EncryptedKey   string   `envconfig:"DRONE_SECRET_ENCRYPTED_KEY"`
+		EncryptedRepos []string `envconfig:"DRONE_SECRET_ENCRYPTED_REPOS"`
+
+		VaultAddress    string   `envconfig:"DRONE_SECRET_VAULT_ADDRESS"`
+		VaultMount      string   `envconfig:"DRONE_SECRET_VAULT_MOUNT" default:"secret"`
+		VaultToken      string   `envconfig:"DRONE_SECRET_VAULT_TOKEN"`
+		VaultRoleID     string   `envconfig:"DRONE_SECRET_VAULT_ROLE_ID"`
+		VaultSecretID   string   `envconfig:"DRONE_SECRET_VAULT_SECRET_ID"`
+		VaultSkipVerify bool     `envconfig:"DRONE_SECRET_VAULT_SKIP_VERIFY"`
+		VaultRepos      []string `envconfig:"DRONE_SECRET_VAULT_REPOS"`
 	}
 }
 
+// BytesSize stores a human-readable size in bytes, kibibytes,
+// mebibytes, gibibytes, or tebibytes (eg. "44kiB", "17MiB").
+type BytesSize int64
+
+// Decode implements the envconfig decoder interface.
+func (b *BytesSize) Decode(value string) error {
+	v, err := units.RAMInBytes(value)
+	*b = BytesSize(v)
+	return err
+}
+
 // FromEnviron loads the configuration from the environment.
 func FromEnviron() (Config, error) {
 	var config Config
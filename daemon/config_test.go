@@ -3,3 +3,29 @@
 // that can be found in the LICENSE file.
 
 package daemon
+
+import "testing"
+
+func TestBytesSize(t *testing.T) {
+	tests := map[string]BytesSize{
+		"1024":  1024,
+		"1KiB":  1024,
+		"512mb": 536870912,
+		"2GiB":  2147483648,
+	}
+	for value, want := range tests {
+		var got BytesSize
+		if err := got.Decode(value); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Want %s decoded to %d, got %d", value, want, got)
+		}
+	}
+
+	var b BytesSize
+	if err := b.Decode("invalid"); err == nil {
+		t.Errorf("Want error when invalid size")
+	}
+}
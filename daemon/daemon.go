@@ -8,13 +8,25 @@ package daemon
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
+	"github.com/drone-runners/drone-runner-exec/internal/disk"
+	"github.com/drone-runners/drone-runner-exec/internal/health"
+	"github.com/drone-runners/drone-runner-exec/internal/janitor"
+	"github.com/drone-runners/drone-runner-exec/internal/load"
 	"github.com/drone-runners/drone-runner-exec/internal/match"
+	"github.com/drone-runners/drone-runner-exec/internal/report"
+	"github.com/drone-runners/drone-runner-exec/internal/secrets"
 	"github.com/drone-runners/drone-runner-exec/runtime"
 
+	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/handler/router"
 	"github.com/drone/runner-go/logger"
@@ -24,15 +36,33 @@ import (
 	"github.com/drone/runner-go/secret"
 	"github.com/drone/runner-go/server"
 
+	"github.com/99designs/basicauth-go"
 	"github.com/orandin/lumberjackrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
 
-// Run runs the service and blocks until complete.
-func Run(ctx context.Context, config Config) error {
+// interval at which the janitor removes orphaned and kept
+// workspaces.
+const janitorInterval = 10 * time.Minute
+
+// interval at which the server is pinged to check readiness.
+const pingInterval = 30 * time.Second
+
+// Run runs the service and blocks until complete. The runner
+// stops polling for pending stages when the drain channel is
+// closed, and returns when the running stages complete. The
+// running stages are cancelled when the context is cancelled,
+// or when the drain deadline expires.
+func Run(ctx context.Context, drain <-chan struct{}, config Config) error {
 	setupLogger(config)
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	cli := client.New(
 		config.Client.Address,
 		config.Client.Secret,
@@ -49,36 +79,134 @@ func Run(ctx context.Context, config Config) error {
 		),
 	)
 
-	engine := engine.New()
+	root := config.Runner.Root
+	if root == "" {
+		root = os.TempDir()
+	}
+
+	// the runner is paused while the host is below the minimum
+	// free disk space or inodes. The guard is disabled unless a
+	// minimum is configured.
+	guard := &disk.Guard{
+		Path:      root,
+		MinFree:   int64(config.Disk.MinFree),
+		MinInodes: config.Disk.MinInodes,
+	}
+
+	// in adaptive capacity mode, the runner only requests and
+	// accepts stages while the host load is below the limits.
+	// The configured capacity is the maximum number of stages.
+	limiter := &load.Limiter{
+		MaxLoad:           config.Load.MaxLoad,
+		MaxMemoryPressure: config.Load.MaxMemoryPressure,
+		MaxCPU:            config.Load.MaxCPU,
+		Settle:            config.Load.Settle,
+	}
+
+	// the readiness checker records the result of each ping
+	// and request round-trip to the server.
+	checker := health.New(root, guard.Check)
+	checked := checker.Client(cli)
+
+	keep, err := runtime.ParseKeep(config.Runner.Keep)
+	if err != nil {
+		return err
+	}
+
+	limits := engine.Limits{
+		Memory: int64(config.Limit.Memory),
+		CPU:    config.Limit.CPU,
+		Pids:   config.Limit.Pids,
+	}
+
+	engine := engine.New(engine.Opts{
+		GracePeriod: config.Runner.Grace,
+		Cgroup:      config.Limit.Cgroup,
+	})
 	remote := remote.New(cli)
 	tracer := history.New(remote)
 	hook := loghistory.New()
 	logrus.AddHook(hook)
 
+	// the artifact store is an S3-compatible bucket, or a
+	// directory on the host machine.
+	var store artifact.Store
+	switch {
+	case config.Artifacts.Bucket != "":
+		store, err = artifact.S3(artifact.S3Config{
+			Endpoint:  config.Artifacts.Endpoint,
+			Bucket:    config.Artifacts.Bucket,
+			Region:    config.Artifacts.Region,
+			AccessKey: config.Artifacts.AccessKey,
+			SecretKey: config.Artifacts.SecretKey,
+			PathStyle: config.Artifacts.PathStyle,
+		})
+		if err != nil {
+			return err
+		}
+	case config.Artifacts.Dir != "":
+		store = artifact.Local(config.Artifacts.Dir)
+	}
+
+	provider, err := setupSecrets(config)
+	if err != nil {
+		return err
+	}
+
+	// pipelines execute in the sandbox if enabled, unless the
+	// repository is excluded, and is granted full access to
+	// the host machine.
+	var sandbox func(*drone.Repo, *drone.Build) bool
+	if config.Sandbox.Enabled {
+		exclude := match.Any(
+			config.Sandbox.Repos,
+			config.Sandbox.Trusted,
+		)
+		sandbox = func(repo *drone.Repo, build *drone.Build) bool {
+			return exclude(repo, build) == false
+		}
+	}
+
 	poller := &runtime.Poller{
-		Client: cli,
+		Client: checked,
+		Drain:  drain,
+		Guard: func() error {
+			if err := guard.Check(); err != nil {
+				return err
+			}
+			return limiter.Check()
+		},
 		Runner: &runtime.Runner{
-			Client:   cli,
-			Environ:  config.Runner.Environ,
-			Machine:  config.Runner.Name,
-			Root:     config.Runner.Root,
-			Symlinks: config.Runner.Symlinks,
+			Client:      cli,
+			Environ:     config.Runner.Environ,
+			Machine:     config.Runner.Name,
+			Root:        config.Runner.Root,
+			Symlinks:    config.Runner.Symlinks,
+			User:        config.Runner.User,
+			Group:       config.Runner.Group,
+			Limits:      limits,
+			Sandbox:     sandbox,
+			SecretFiles: config.Secret.Files,
+			Guard: func() error {
+				if err := guard.Check(); err != nil {
+					return err
+				}
+				return limiter.Admit()
+			},
 			Reporter: tracer,
 			Match: match.Func(
 				config.Limit.Repos,
 				config.Limit.Events,
 				config.Limit.Trusted,
 			),
-			Secret: secret.External(
-				config.Secret.Endpoint,
-				config.Secret.Token,
-				config.Secret.SkipVerify,
-			),
+			Secret: provider,
 			Execer: runtime.NewExecer(
 				tracer,
 				remote,
 				engine,
 				config.Runner.Procs,
+				keep,
+				store,
 			),
 		},
 		Filter: &client.Filter{
@@ -92,14 +220,36 @@ func Run(ctx context.Context, config Config) error {
 		},
 	}
 
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "drone_runner_workspace_bytes",
+		Help: "Disk space used by the pipeline workspaces.",
+	}, workspaceUsage(root))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", health.HandleHealth())
+	mux.Handle("/readyz", health.HandleReady(checker))
+
+	// the test reports require the dashboard authentication,
+	// if a dashboard password is configured.
+	reports := report.Handler()
+	if config.Dashboard.Password != "" {
+		auth := basicauth.New(config.Dashboard.Realm, map[string][]string{
+			config.Dashboard.Username: {config.Dashboard.Password},
+		})
+		reports = auth(reports)
+	}
+	mux.Handle("/reports", reports)
+	mux.Handle("/", router.New(tracer, hook, router.Config{
+		Username: config.Dashboard.Username,
+		Password: config.Dashboard.Password,
+		Realm:    config.Dashboard.Realm,
+	}))
+
 	var g errgroup.Group
 	server := server.Server{
-		Addr: config.Server.Port,
-		Handler: router.New(tracer, hook, router.Config{
-			Username: config.Dashboard.Username,
-			Password: config.Dashboard.Password,
-			Realm:    config.Dashboard.Realm,
-		}),
+		Addr:    config.Server.Port,
+		Handler: mux,
 	}
 
 	logrus.WithField("addr", config.Server.Port).
@@ -109,40 +259,86 @@ func Run(ctx context.Context, config Config) error {
 		return server.ListenAndServe(ctx)
 	})
 
+	// the janitor removes orphaned workspaces, left behind if
+	// the runner exits before a pipeline completes, and removes
+	// kept workspaces when they expire or exceed the disk budget.
+	janitor := &janitor.Janitor{
+		Root:   root,
+		TTL:    config.Runner.KeepTTL,
+		Budget: int64(config.Runner.KeepBudget),
+	}
+	g.Go(func() error {
+		janitor.Start(ctx, janitorInterval)
+		return nil
+	})
+
 	// Ping the server and block until a successful connection
 	// to the server has been established.
 	for {
-		err := cli.Ping(ctx, config.Runner.Name)
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
-		if ctx.Err() != nil {
-			break
-		}
-		if err != nil {
-			logrus.WithError(err).
-				Errorln("cannot ping the remote server")
-			time.Sleep(time.Second)
-		} else {
+		err := checked.Ping(ctx, config.Runner.Name)
+		if err == nil {
 			logrus.Infoln("successfully pinged the remote server")
 			break
 		}
+		logrus.WithError(err).
+			Errorln("cannot ping the remote server")
+		select {
+		case <-time.After(time.Second):
+			continue
+		case <-ctx.Done():
+		case <-drain:
+		}
+		// the server and janitor are stopped if the runner
+		// exits before a connection is established.
+		cancel()
+		g.Wait()
+		return nil
 	}
 
+	// the server is pinged periodically, since requests for
+	// pending stages may block for extended periods of time.
+	g.Go(func() error {
+		checker.Ping(ctx, cli, config.Runner.Name, pingInterval)
+		return nil
+	})
+
 	g.Go(func() error {
 		logrus.WithField("capacity", config.Runner.Capacity).
+			WithField("adaptive", limiter.Enabled()).
 			WithField("endpoint", config.Client.Address).
 			WithField("kind", resource.Kind).
 			WithField("type", resource.Type).
 			Infoln("polling the remote server")
 
 		poller.Poll(ctx, config.Runner.Capacity)
+
+		// the server and janitor are stopped once the running
+		// stages complete.
+		cancel()
 		return nil
 	})
 
-	err := g.Wait()
+	// the running stages are cancelled if they do not complete
+	// before the drain deadline.
+	go func() {
+		select {
+		case <-drain:
+		case <-ctx.Done():
+			return
+		}
+		logrus.WithField("timeout", config.Runner.Drain).
+			Infoln("draining the runner")
+		timer := time.NewTimer(config.Runner.Drain)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			logrus.Warnln("drain deadline exceeded, cancelling running stages")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = g.Wait()
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("shutting down the server")
@@ -150,6 +346,72 @@ func Run(ctx context.Context, config Config) error {
 	return err
 }
 
+// helper function returns a function that computes the disk
+// space used by the pipeline workspaces. The disk usage is
+// computed at most once per minute, since computing the disk
+// usage walks the workspace directories.
+func workspaceUsage(root string) func() float64 {
+	var mu sync.Mutex
+	var usage int64
+	var updated time.Time
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(updated) > time.Minute {
+			usage = janitor.Usage(root)
+			updated = time.Now()
+		}
+		return float64(usage)
+	}
+}
+
+// helper function returns the secret provider. Secrets are
+// requested from the secret plugin, and from the built-in
+// providers, in that order. Each built-in provider is scoped
+// to the configured repositories.
+func setupSecrets(config Config) (secret.Provider, error) {
+	providers := []secret.Provider{
+		secret.External(
+			config.Secret.Endpoint,
+			config.Secret.Token,
+			config.Secret.SkipVerify,
+		),
+	}
+	if path := config.Secret.Dir; path != "" {
+		providers = append(providers, secrets.Scope(
+			secrets.Dir(path),
+			config.Secret.DirRepos,
+		))
+	}
+	if path := config.Secret.EncryptedFile; path != "" {
+		provider, err := secrets.File(path, config.Secret.EncryptedKey)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, secrets.Scope(
+			provider,
+			config.Secret.EncryptedRepos,
+		))
+	}
+	if config.Secret.VaultAddress != "" {
+		if config.Secret.VaultToken == "" && config.Secret.VaultRoleID == "" {
+			return nil, errors.New("vault secrets require a token or approle credentials")
+		}
+		providers = append(providers, secrets.Scope(
+			secrets.Vault(secrets.VaultConfig{
+				Address:    config.Secret.VaultAddress,
+				Mount:      config.Secret.VaultMount,
+				Token:      config.Secret.VaultToken,
+				RoleID:     config.Secret.VaultRoleID,
+				SecretID:   config.Secret.VaultSecretID,
+				SkipVerify: config.Secret.VaultSkipVerify,
+			}),
+			config.Secret.VaultRepos,
+		))
+	}
+	return secret.Combine(providers...), nil
+}
+
 // helper function configures the global logger from
 // the loaded configuration.
 func setupLogger(config Config) error {
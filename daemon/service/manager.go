@@ -6,6 +6,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/drone-runners/drone-runner-exec/daemon"
 
@@ -14,9 +15,18 @@ import (
 
 var nocontext = context.Background()
 
+// windowsStopTimeout is the maximum time the service waits for
+// the running stages to drain on windows, where the service
+// control manager terminates a service that does not stop in
+// time.
+const windowsStopTimeout = 20 * time.Second
+
 // a manager manages the service lifecycle.
 type manager struct {
-	cancel context.CancelFunc
+	cancel  context.CancelFunc
+	drain   chan struct{}
+	done    chan struct{}
+	timeout time.Duration
 }
 
 // Start starts the service in a separate go routine.
@@ -27,12 +37,32 @@ func (m *manager) Start(service.Service) error {
 	}
 	ctx, cancel := context.WithCancel(nocontext)
 	m.cancel = cancel
-	go daemon.Run(ctx, config)
+	m.drain = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		daemon.Run(ctx, m.drain, config)
+		close(m.done)
+	}()
 	return nil
 }
 
-// Stop stops the service.
+// Stop stops the service. Stop drains the runner and blocks
+// until the running stages complete, or the drain deadline
+// expires. If the manager defines a stop timeout, the running
+// stages are cancelled once the timeout expires.
 func (m *manager) Stop(service.Service) error {
-	m.cancel()
+	close(m.drain)
+	if m.timeout == 0 {
+		<-m.done
+		return nil
+	}
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+	select {
+	case <-m.done:
+	case <-timer.C:
+		m.cancel()
+		<-m.done
+	}
 	return nil
 }
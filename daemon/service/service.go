@@ -54,5 +54,8 @@ func New(conf Config) (service.Service, error) {
 	}
 
 	m := new(manager)
+	if runtime.GOOS == "windows" {
+		m.timeout = windowsStopTimeout
+	}
 	return service.New(m, config)
 }
@@ -0,0 +1,257 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+// cgroup v2 filesystem magic number.
+const cgroup2Magic = 0x63677270
+
+// cpu period, in microseconds, used to calculate the cpu quota.
+const cpuPeriod = 100000
+
+// controllers enabled for the pipeline cgroups.
+const controllers = "+memory +cpu +pids"
+
+// maximum amount of time to wait for the processes in a cgroup
+// to exit after the cgroup is killed.
+const killTimeout = 5 * time.Second
+
+// cgroupMu serializes the creation and removal of the stage
+// cgroup, which is removed when its last step cgroup is
+// removed.
+var cgroupMu sync.Mutex
+
+// helper function returns true if the path is located on a
+// cgroup v2 filesystem.
+var isCgroup2 = isCgroup2Default
+
+func isCgroup2Default(path string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false
+	}
+	return stat.Type == cgroup2Magic
+}
+
+// helper function returns true if the kernel supports starting
+// a process in a cgroup, which requires Linux 5.7 or higher.
+var cloneIntoCgroup = cloneIntoCgroupDefault
+
+func cloneIntoCgroupDefault() bool {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return false
+	}
+	var release []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	var major, minor int
+	fmt.Sscanf(string(release), "%d.%d", &major, &minor)
+	return major > 5 || (major == 5 && minor >= 7)
+}
+
+// cgroup is a cgroup v2 control group that limits the resources
+// of a single pipeline step.
+type cgroup struct {
+	path string
+}
+
+// helper function creates a cgroup for the pipeline step, with
+// the resource limits defined in the pipeline spec. The cgroup
+// is created in a stage cgroup, nested in the root cgroup.
+func createCgroup(root string, spec *Spec, step *Step) (*cgroup, error) {
+	if root == "" || spec.Limits == nil {
+		return nil, nil
+	}
+	if !isCgroup2(filepath.Dir(root)) {
+		return nil, fmt.Errorf("cgroup: %s is not a cgroup v2 filesystem", filepath.Dir(root))
+	}
+
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+
+	// the controllers must be enabled in each parent cgroup,
+	// which must not contain any processes.
+	stage := filepath.Join(root, filepath.Base(spec.Root))
+	for _, dir := range []string{root, stage} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFile(dir, "cgroup.subtree_control", controllers); err != nil {
+			return nil, err
+		}
+	}
+
+	// the step cgroup name is unique, since step names may
+	// produce the same slug, and the cgroup is killed when the
+	// step exits.
+	path, err := ioutil.TempDir(stage, slug.Make(step.Name)+"-")
+	if err != nil {
+		return nil, err
+	}
+	cg := &cgroup{path: path}
+
+	// the limits are written while the lock is held, so the
+	// cgroup cannot be removed before the limits are applied.
+	limits := spec.Limits
+	if limits.Memory > 0 {
+		if err := writeFile(path, "memory.max", fmt.Sprint(limits.Memory)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+		// swap is disabled so that the memory limit is
+		// enforced. the swap controller is optional.
+		writeFile(path, "memory.swap.max", "0")
+	}
+	if limits.CPU > 0 {
+		quota := int64(limits.CPU * cpuPeriod)
+		if err := writeFile(path, "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	if limits.Pids > 0 {
+		if err := writeFile(path, "pids.max", fmt.Sprint(limits.Pids)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+// attach configures the command to start in the cgroup, so
+// that processes forked by the command before it could be moved
+// into the cgroup do not escape the resource limits. Starting a
+// process in a cgroup requires Linux 5.7 or higher; on older
+// kernels the command is not configured, and the process is
+// moved into the cgroup by join once it starts. The returned
+// file, if any, must be closed once the command is started.
+func (c *cgroup) attach(cmd *exec.Cmd) (*os.File, error) {
+	if !cloneIntoCgroup() {
+		return nil, nil
+	}
+	f, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return f, nil
+}
+
+// join moves the started process into the cgroup, if the
+// process was not started in the cgroup. Processes forked by
+// the command before it is moved remain outside the cgroup.
+func (c *cgroup) join(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.UseCgroupFD {
+		return nil
+	}
+	return writeFile(c.path, "cgroup.procs", strconv.Itoa(cmd.Process.Pid))
+}
+
+// oomKilled returns true if a process in the cgroup was killed
+// by the kernel out of memory killer.
+func (c *cgroup) oomKilled() bool {
+	return readEvents(c.path, "memory.events")["oom_kill"] > 0
+}
+
+// destroy kills any remaining processes in the cgroup, waits
+// for the processes to exit, and removes the cgroup. The stage
+// cgroup is also removed once it contains no step cgroups, so
+// that the cgroups are removed even if the workspace is kept.
+func (c *cgroup) destroy() error {
+	// the kill file is only available in newer kernels. the
+	// process group is expected to be killed regardless.
+	writeFile(c.path, "cgroup.kill", "1")
+
+	// the cgroup cannot be removed until the killed processes
+	// have exited.
+	deadline := time.Now().Add(killTimeout)
+	for readEvents(c.path, "cgroup.events")["populated"] != 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cgroup: %s is still populated", c.path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+	if err := c.remove(); err != nil {
+		return err
+	}
+	// the stage cgroup cannot be removed while other steps are
+	// running, in which case it is removed by the last step.
+	syscall.Rmdir(filepath.Dir(c.path))
+	return nil
+}
+
+// remove removes the cgroup.
+func (c *cgroup) remove() error {
+	err := syscall.Rmdir(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// helper function removes the stage cgroup.
+func destroyCgroup(root string, spec *Spec) error {
+	if root == "" || spec.Limits == nil {
+		return nil
+	}
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+	err := syscall.Rmdir(filepath.Join(root, filepath.Base(spec.Root)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// helper function reads the named cgroup interface file of
+// flat keyed values. A missing file has no values.
+func readEvents(dir, name string) map[string]int64 {
+	events := map[string]int64{}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return events
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		var key string
+		var value int64
+		fmt.Sscan(scanner.Text(), &key, &value)
+		events[key] = value
+	}
+	return events
+}
+
+// helper function writes the value to the named cgroup
+// interface file.
+func writeFile(dir, name, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+}
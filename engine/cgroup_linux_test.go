@@ -0,0 +1,171 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCreateCgroup(t *testing.T) {
+	isCgroup2 = func(string) bool { return true }
+	defer func() {
+		isCgroup2 = isCgroup2Default
+	}()
+
+	root := filepath.Join(t.TempDir(), "drone")
+	spec := &Spec{
+		Root: "/tmp/drone-random",
+		Limits: &Limits{
+			Memory: 1073741824,
+			CPU:    1.5,
+			Pids:   100,
+		},
+	}
+	step := &Step{Name: "go build"}
+
+	cg, err := createCgroup(root, spec, step)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := cg.path, filepath.Join(root, "drone-random", "go-build-"); !strings.HasPrefix(got, want) {
+		t.Errorf("Want cgroup path prefix %s, got %s", want, got)
+	}
+
+	tests := map[string]string{
+		filepath.Join(root, "cgroup.subtree_control"):                 controllers,
+		filepath.Join(root, "drone-random", "cgroup.subtree_control"): controllers,
+		filepath.Join(cg.path, "memory.max"):                          "1073741824",
+		filepath.Join(cg.path, "memory.swap.max"):                     "0",
+		filepath.Join(cg.path, "cpu.max"):                             "150000 100000",
+		filepath.Join(cg.path, "pids.max"):                            "100",
+	}
+	for path, want := range tests {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := string(raw); got != want {
+			t.Errorf("Want %s value %q, got %q", path, want, got)
+		}
+	}
+
+	cmd := exec.Command("/bin/true")
+	f, err := cg.attach(cmd)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer f.Close()
+	if !cmd.SysProcAttr.UseCgroupFD || cmd.SysProcAttr.CgroupFD != int(f.Fd()) {
+		t.Errorf("Want process started in cgroup")
+	}
+}
+
+// This test verifies that steps with the same name are created
+// in separate cgroups.
+func TestCreateCgroup_Unique(t *testing.T) {
+	isCgroup2 = func(string) bool { return true }
+	defer func() {
+		isCgroup2 = isCgroup2Default
+	}()
+
+	root := filepath.Join(t.TempDir(), "drone")
+	spec := &Spec{
+		Root:   "/tmp/drone-random",
+		Limits: &Limits{Pids: 100},
+	}
+	a, err := createCgroup(root, spec, &Step{Name: "go build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := createCgroup(root, spec, &Step{Name: "go-build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.path == b.path {
+		t.Errorf("Want unique cgroup path for each step, got %s", a.path)
+	}
+}
+
+// This test verifies that the process is moved into the cgroup
+// once it starts if the kernel cannot start the process in the
+// cgroup.
+func TestCgroup_Join(t *testing.T) {
+	cloneIntoCgroup = func() bool { return false }
+	defer func() {
+		cloneIntoCgroup = cloneIntoCgroupDefault
+	}()
+
+	cg := &cgroup{path: t.TempDir()}
+	cmd := exec.Command("/bin/true")
+	f, err := cg.attach(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != nil {
+		f.Close()
+		t.Errorf("Want process not started in cgroup")
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+
+	if err := cg.join(cmd); err != nil {
+		t.Error(err)
+	}
+	raw, _ := ioutil.ReadFile(filepath.Join(cg.path, "cgroup.procs"))
+	if got, want := string(raw), strconv.Itoa(cmd.Process.Pid); got != want {
+		t.Errorf("Want cgroup procs %s, got %s", want, got)
+	}
+}
+
+func TestCreateCgroup_NoLimits(t *testing.T) {
+	cg, err := createCgroup(t.TempDir(), new(Spec), new(Step))
+	if err != nil {
+		t.Error(err)
+	}
+	if cg != nil {
+		t.Errorf("Want no cgroup when no resource limits defined")
+	}
+}
+
+func TestCreateCgroup_NotCgroup2(t *testing.T) {
+	spec := &Spec{
+		Root:   "/tmp/drone-random",
+		Limits: &Limits{Pids: 100},
+	}
+	root := filepath.Join(t.TempDir(), "drone")
+	if _, err := createCgroup(root, spec, new(Step)); err == nil {
+		t.Errorf("Want error when root is not a cgroup v2 filesystem")
+	}
+}
+
+func TestCgroup_OOMKilled(t *testing.T) {
+	dir := t.TempDir()
+	cg := &cgroup{path: dir}
+	if cg.oomKilled() {
+		t.Errorf("Want oom killed false when memory events unavailable")
+	}
+
+	events := "low 0\nhigh 0\nmax 3\noom 1\noom_kill 0\n"
+	ioutil.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0644)
+	if cg.oomKilled() {
+		t.Errorf("Want oom killed false when no process killed")
+	}
+
+	events = "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"
+	ioutil.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0644)
+	if !cg.oomKilled() {
+		t.Errorf("Want oom killed true when process killed")
+	}
+}
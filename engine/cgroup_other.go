@@ -0,0 +1,33 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// cgroup is a no-op control group for systems that do not
+// support cgroups.
+type cgroup struct{}
+
+// helper function returns an error if resource limits are
+// defined, which are only supported on linux.
+func createCgroup(root string, spec *Spec, step *Step) (*cgroup, error) {
+	if root == "" || spec.Limits == nil {
+		return nil, nil
+	}
+	return nil, errors.New("cgroup: resource limits are only supported on linux")
+}
+
+func (c *cgroup) attach(cmd *exec.Cmd) (*os.File, error) { return nil, nil }
+func (c *cgroup) join(cmd *exec.Cmd) error                { return nil }
+func (c *cgroup) oomKilled() bool                         { return false }
+func (c *cgroup) destroy() error                          { return nil }
+
+func destroyCgroup(root string, spec *Spec) error { return nil }
@@ -8,7 +8,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
@@ -83,24 +85,66 @@ type Compiler struct {
 	// Symlinks provides an optional list of symlinks that are
 	// created and linked to the pipeline workspace.
 	Symlinks map[string]string
+
+	// User defines the optional operating system user used to
+	// execute the pipeline steps, defaults to the runner user.
+	// The user can be overridden by the pipeline.
+	User string
+
+	// Group defines the optional operating system group used
+	// to execute the pipeline steps, defaults to the primary
+	// group of the user.
+	Group string
+
+	// Limits defines the default resource limits applied to
+	// each pipeline step. The pipeline may lower, but not
+	// exceed, the default limits.
+	Limits engine.Limits
+
+	// Sandbox configures the pipeline steps to execute in the
+	// sandbox, with read-only access to the host filesystem.
+	Sandbox bool
+
+	// SecretFiles configures the pipeline steps to receive
+	// masked secrets as files, instead of environment variables.
+	// The path of each file is exported to the step environment
+	// as the secret variable name with a _FILE suffix.
+	SecretFiles bool
+
+	// Select optionally configures the subset of pipeline
+	// steps to execute, before the secrets are resolved. The
+	// secrets of steps that do not execute are not required.
+	Select func(*engine.Spec) error
 }
 
-// Compile compiles the configuration file.
-func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
+// Compile compiles the configuration file. An error is returned
+// if the secrets referenced by the pipeline steps cannot be
+// found, unless the step is optional.
+func (c *Compiler) Compile(ctx context.Context) (*engine.Spec, error) {
 	spec := new(engine.Spec)
 
-	if c.Root != "" {
-		spec.Root = filepath.Join(
-			c.Root,
-			fmt.Sprintf("drone-%s", random()),
-		)
-	} else {
-		spec.Root = filepath.Join(
-			tempdir(),
-			fmt.Sprintf("drone-%s", random()),
-		)
+	root := c.Root
+	if root == "" {
+		root = tempdir()
+	}
+	spec.Root = filepath.Join(
+		root,
+		fmt.Sprintf("drone-%s", random()),
+	)
+
+	// configures the operating system user and group used to
+	// execute the pipeline steps. The pipeline user takes
+	// precedence over the default user.
+	spec.User = c.User
+	spec.Group = c.Group
+	if c.Pipeline.User != "" {
+		spec.User = c.Pipeline.User
+		spec.Group = ""
 	}
 
+	spec.Limits = convertLimits(c.Limits, c.Pipeline.Limits)
+	spec.Sandbox = c.Sandbox
+
 	spec.Platform.OS = c.Pipeline.Platform.OS
 	spec.Platform.Arch = c.Pipeline.Platform.Arch
 	spec.Platform.Variant = c.Pipeline.Platform.Variant
@@ -122,13 +166,34 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		IsDir: true,
 	})
 
-	// creates the opt directory to hold all scripts.
+	// creates the opt directory to hold all scripts. The
+	// directory is protected, since it holds the directories
+	// written by the runner process.
 	spec.Files = append(spec.Files, &engine.File{
-		Path:  filepath.Join(spec.Root, "opt"),
-		Mode:  0700,
-		IsDir: true,
+		Path:      filepath.Join(spec.Root, "opt"),
+		Mode:      0755,
+		IsDir:     true,
+		Protected: true,
 	})
 
+	// configures the workspace cache, which is stored in a
+	// per-repository directory in the build root.
+	if c.Pipeline.Cache != nil && len(c.Pipeline.Cache.Paths) != 0 {
+		cachedir := filepath.Join(root, "drone-cache", cacheName(c.Repo))
+		spec.Cache = convertCache(cachedir, homedir, sourcedir, c.Pipeline.Cache)
+	}
+
+	// creates a temporary directory in the root. The host
+	// temporary directory is read-only in the sandbox.
+	tmpdir := filepath.Join(spec.Root, "tmp")
+	if c.Sandbox {
+		spec.Files = append(spec.Files, &engine.File{
+			Path:  tmpdir,
+			Mode:  0700,
+			IsDir: true,
+		})
+	}
+
 	// creates the netrc file
 	if c.Netrc != nil {
 		netrcpath := filepath.Join(homedir, netrc)
@@ -184,6 +249,31 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		},
 	)
 
+	// the user variable is inherited from the host, and must
+	// be updated to reflect the pipeline user.
+	if spec.User != "" {
+		envs["USER"] = spec.User
+	}
+
+	if c.Sandbox {
+		envs["TMPDIR"] = tmpdir
+	}
+
+	// creates the reports directory in the root, where the test
+	// report summaries are written for use by subsequent steps.
+	// The directory is protected, since the summaries are
+	// written by the runner process.
+	reportdir := filepath.Join(spec.Root, "opt", "reports")
+	if hasReports(c.Pipeline) {
+		spec.Files = append(spec.Files, &engine.File{
+			Path:      reportdir,
+			Mode:      0755,
+			IsDir:     true,
+			Protected: true,
+		})
+		envs["DRONE_REPORTS_DIR"] = reportdir
+	}
+
 	// create clone step, maybe
 	if c.Pipeline.Clone.Disable == false {
 		clonepath := filepath.Join(spec.Root, "opt", "clone"+shell.Suffix)
@@ -221,8 +311,19 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		})
 	}
 
-	// create steps
-	for _, src := range c.Pipeline.Steps {
+	// the pipeline steps are expanded for each combination of
+	// the matrix values. If the pipeline does not define an
+	// execution graph, the steps of each combination execute
+	// serially, and the combinations execute in parallel.
+	steps := Expand(c.Pipeline)
+	serial := !hasDependencies(c.Pipeline)
+	matrix := len(c.Pipeline.Matrix) != 0
+	optional := map[string]bool{}
+
+	// create steps. The pipeline environment variables are
+	// merged beneath the step environment variables.
+	for i, src := range steps {
+		environment := mergeEnv(c.Pipeline.Environment, src.Environment)
 		buildslug := slug.Make(src.Name)
 		buildpath := filepath.Join(spec.Root, "opt", buildslug+shell.Suffix)
 		buildfile := shell.Script(src.Commands)
@@ -236,7 +337,7 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 			DependsOn: src.DependsOn,
 			Envs: environ.Combine(envs,
 				environ.Expand(
-					convertStaticEnv(src.Environment),
+					convertStaticEnv(environment),
 				),
 			),
 			IgnoreErr:    strings.EqualFold(src.Failure, "ignore"),
@@ -250,10 +351,19 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 					Data: []byte(buildfile),
 				},
 			},
-			Secrets:    convertSecretEnv(src.Environment),
+			Ready:      convertReady(src.Ready),
+			Reports:    convertReports(sourcedir, reportdir, buildslug, src.Reports),
+			Retry:      convertRetry(src.Retry),
+			Secrets:    convertSecretEnv(environment),
+			Timeout:    src.Timeout,
 			WorkingDir: sourcedir,
 		}
 		spec.Steps = append(spec.Steps, dst)
+		optional[dst.Name] = src.Optional
+
+		if matrix && serial && i%len(c.Pipeline.Steps) != 0 {
+			dst.DependsOn = []string{steps[i-1].Name}
+		}
 
 		// set the pipeline step run policy. steps run on
 		// success by default, but may be optionally configured
@@ -280,7 +390,7 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		}
 	}
 
-	if isGraph(spec) == false {
+	if isGraph(spec) == false && !matrix {
 		configureSerial(spec)
 	} else if c.Pipeline.Clone.Disable == false {
 		configureCloneDeps(spec)
@@ -288,19 +398,92 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		removeCloneDeps(spec)
 	}
 
+	// create the artifacts step, which uploads the build
+	// outputs once all other pipeline steps are complete.
+	if len(c.Pipeline.Artifacts) != 0 {
+		dst := &engine.Step{
+			Name: "artifacts",
+			Artifacts: &engine.Artifacts{
+				Dir:   sourcedir,
+				Paths: c.Pipeline.Artifacts,
+				Prefix: path.Join(
+					c.Repo.Slug,
+					fmt.Sprint(c.Build.Number),
+					fmt.Sprint(c.Stage.Number),
+				),
+			},
+			RunPolicy:  engine.RunAlways,
+			WorkingDir: sourcedir,
+		}
+		for _, step := range spec.Steps {
+			dst.DependsOn = append(dst.DependsOn, step.Name)
+		}
+		spec.Steps = append(spec.Steps, dst)
+	}
+
+	if c.Select != nil {
+		if err := c.Select(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	// the secrets are resolved at compile time, once per
+	// secret, and shared by the steps that reference the
+	// secret. The secrets of a step that never runs are not
+	// required.
+	type result struct {
+		found *drone.Secret
+		err   error
+	}
+	resolved := map[string]result{}
+	missing := new(MissingSecretsError)
 	for _, step := range spec.Steps {
+		// the secrets are sorted so that missing secrets are
+		// reported in a consistent order.
+		sort.Slice(step.Secrets, func(i, j int) bool {
+			return step.Secrets[i].Name < step.Secrets[j].Name
+		})
 		for _, s := range step.Secrets {
-			found, _ := c.Secret.Find(ctx, &secret.Request{
-				Name:  s.Name,
-				Build: c.Build,
-				Repo:  c.Repo,
-				Conf:  c.Manifest,
-			})
-			if found != nil {
-				s.Data = []byte(found.Data)
+			res, ok := resolved[s.Name]
+			if !ok {
+				res.found, res.err = c.Secret.Find(ctx, &secret.Request{
+					Name:  s.Name,
+					Build: c.Build,
+					Repo:  c.Repo,
+					Conf:  c.Manifest,
+				})
+				resolved[s.Name] = res
+			}
+			if res.found != nil {
+				s.Data = []byte(res.found.Data)
+			} else if !optional[step.Name] && step.RunPolicy != engine.RunNever {
+				missing.Secrets = append(missing.Secrets, &MissingSecret{
+					Name: s.Name,
+					Step: step.Name,
+					Err:  res.err,
+				})
 			}
 		}
+		if c.SecretFiles {
+			configureSecretFiles(spec, step)
+		}
 	}
 
-	return spec
+	// creates the secrets directory in the root, where the
+	// secret files are written when the steps execute. The
+	// directory is protected, since the files are written by
+	// the runner process.
+	if c.SecretFiles {
+		spec.Files = append(spec.Files, &engine.File{
+			Path:      filepath.Join(spec.Root, "opt", "secrets"),
+			Mode:      0755,
+			IsDir:     true,
+			Protected: true,
+		})
+	}
+
+	if len(missing.Secrets) != 0 {
+		return nil, missing
+	}
+	return spec, nil
 }
@@ -11,7 +11,10 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dchest/uniuri"
 	"github.com/drone-runners/drone-runner-exec/engine"
@@ -89,6 +92,131 @@ func TestCompile_RunFaiure(t *testing.T) {
 	}
 }
 
+// This test verifies that the step timeout defined in the yaml
+// is copied to the intermediate representation.
+func TestCompile_Timeout(t *testing.T) {
+	ir := testCompile(t, "testdata/timeout.yml", "testdata/timeout.json")
+	if got, want := ir.Steps[0].Timeout, 10*time.Minute; got != want {
+		t.Errorf("Want timeout %s, got %s", want, got)
+	}
+	if got, want := ir.Steps[1].Timeout, time.Duration(0); got != want {
+		t.Errorf("Want no timeout, got %s", got)
+	}
+}
+
+// This test verifies that the step retry policy defined in the
+// yaml is copied to the intermediate representation.
+func TestCompile_Retry(t *testing.T) {
+	testCompile(t, "testdata/retry.yml", "testdata/retry.json")
+}
+
+// This test verifies that the pipeline steps are expanded for
+// each matrix value, and that the steps of each matrix value
+// execute serially, in parallel with the other matrix values.
+func TestCompile_Matrix(t *testing.T) {
+	ir := testCompile(t, "testdata/matrix.yml", "testdata/matrix.json")
+	if ir == nil {
+		return
+	}
+	for i, want := range []string{"1.20", "1.20", "1.21", "1.21"} {
+		if got := ir.Steps[i].Envs["GO_VERSION"]; got != want {
+			t.Errorf("Want GO_VERSION %s for step %s, got %s", want, ir.Steps[i].Name, got)
+		}
+	}
+	if got, want := ir.Steps[1].Envs["GOFLAGS"], "-mod=vendor"; got != want {
+		t.Errorf("Want step environment preserved, got %s", got)
+	}
+}
+
+// This test verifies that the artifacts step is appended to
+// the pipeline and depends on all other pipeline steps.
+func TestCompile_Artifacts(t *testing.T) {
+	testCompile(t, "testdata/artifacts.yml", "testdata/artifacts.json")
+}
+
+// This test verifies that the test reports are configured,
+// and that the reports directory is exposed to the steps.
+func TestCompile_Reports(t *testing.T) {
+	ir := testCompile(t, "testdata/reports.yml", "testdata/reports.json")
+	if ir == nil {
+		return
+	}
+	for _, step := range ir.Steps {
+		if got, want := step.Envs["DRONE_REPORTS_DIR"], "/tmp/drone-random/opt/reports"; got != want {
+			t.Errorf("Want reports directory %q, got %q", want, got)
+		}
+	}
+}
+
+// This test verifies that the pipeline user overrides the
+// default user and group.
+func TestCompile_User(t *testing.T) {
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Pipeline = &resource.Pipeline{}
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.User = "drone"
+	compiler.Group = "builders"
+
+	ir, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := ir.User, "drone"; got != want {
+		t.Errorf("Want default user %s, got %s", want, got)
+	}
+	if got, want := ir.Group, "builders"; got != want {
+		t.Errorf("Want default group %s, got %s", want, got)
+	}
+	if got, want := ir.Steps[0].Envs["USER"], "drone"; got != want {
+		t.Errorf("Want USER variable %s, got %s", want, got)
+	}
+
+	compiler.Pipeline.User = "octocat"
+	ir, err = compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := ir.User, "octocat"; got != want {
+		t.Errorf("Want pipeline user %s, got %s", want, got)
+	}
+	if got, want := ir.Group, ""; got != want {
+		t.Errorf("Want primary group of the pipeline user, got %s", got)
+	}
+}
+
+// This test verifies that the pipeline is configured to execute
+// in the sandbox, with a writable temporary directory in the
+// pipeline root.
+func TestCompile_Sandbox(t *testing.T) {
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Pipeline = &resource.Pipeline{}
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Root = "/tmp"
+	compiler.Sandbox = true
+
+	ir, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if ir.Sandbox == false {
+		t.Errorf("Want sandbox enabled")
+	}
+	if got, want := ir.Steps[0].Envs["TMPDIR"], filepath.Join(ir.Root, "tmp"); got != want {
+		t.Errorf("Want TMPDIR variable %s, got %s", want, got)
+	}
+}
+
 // This test verifies that secrets defined in the yaml are
 // requested and stored in the intermediate representation
 // at compile time.
@@ -103,28 +231,196 @@ func TestCompile_Secrets(t *testing.T) {
 	compiler.Manifest = manifest
 	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
 	compiler.Secret = secret.StaticVars(map[string]string{
+		"my_password": "correct-horse-battery-staple",
 		"my_username": "octocat",
 	})
-	ir := compiler.Compile(nocontext)
+	ir, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
 	got := ir.Steps[0].Secrets
 	want := []*engine.Secret{
 		{
 			Name: "my_password",
 			Env:  "PASSWORD",
-			Data: nil, // secret not found, data nil
+			Data: []byte("correct-horse-battery-staple"),
 			Mask: true,
 		},
 		{
 			Name: "my_username",
 			Env:  "USERNAME",
-			Data: []byte("octocat"), // secret found
+			Data: []byte("octocat"),
 			Mask: true,
 		},
 	}
 	if diff := cmp.Diff(got, want); len(diff) != 0 {
-		// TODO(bradrydzewski) ordering is not guaranteed. this
-		// unit tests needs to be adjusted accordingly.
-		t.Skipf(diff)
+		t.Errorf(diff)
+	}
+}
+
+// This test verifies that an error is returned, listing each
+// secret that cannot be found, unless the step is optional or
+// is not selected.
+func TestCompile_SecretsMissing(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/secret.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Netrc = &drone.Netrc{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(map[string]string{
+		"my_username": "octocat",
+	})
+
+	_, err := compiler.Compile(nocontext)
+	missing, ok := err.(*MissingSecretsError)
+	if !ok {
+		t.Errorf("Want missing secrets error, got %v", err)
+		return
+	}
+	want := []*MissingSecret{{Name: "my_password", Step: "build"}}
+	if diff := cmp.Diff(missing.Secrets, want); len(diff) != 0 {
+		t.Errorf(diff)
+	}
+	if got, want := err.Error(), "cannot find secrets: my_password (step build)"; got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+
+	// the secrets of steps that are not selected are not
+	// required.
+	compiler.Select = func(spec *engine.Spec) error {
+		spec.Steps[0].RunPolicy = engine.RunNever
+		return nil
+	}
+	if _, err := compiler.Compile(nocontext); err != nil {
+		t.Errorf("Want missing secrets tolerated for unselected step, got %s", err)
+	}
+	compiler.Select = nil
+
+	compiler.Pipeline.Steps[0].Optional = true
+	ir, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Errorf("Want missing secrets tolerated for optional step, got %s", err)
+		return
+	}
+	for _, s := range ir.Steps[0].Secrets {
+		if s.Name == "my_password" && s.Data != nil {
+			t.Errorf("Want missing secret data nil")
+		}
+	}
+}
+
+// This test verifies that masked secrets are assigned files in
+// the opt directory when secret files are enabled, and that the
+// file paths are exported to the step environment.
+func TestCompile_SecretFiles(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/secret.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Netrc = &drone.Netrc{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(map[string]string{
+		"my_password": "correct-horse-battery-staple",
+		"my_username": "octocat",
+	})
+	compiler.Root = "/tmp"
+	compiler.SecretFiles = true
+
+	ir, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	step := ir.Steps[0]
+	dir := filepath.Join(ir.Root, "opt", "secrets", uniqueSlug(step.Name))
+	for _, s := range step.Secrets {
+		path := filepath.Join(dir, s.Env)
+		if got, want := s.File, path; got != want {
+			t.Errorf("Want secret %s file %s, got %s", s.Name, want, got)
+		}
+		if got, want := step.Envs[s.Env+"_FILE"], path; got != want {
+			t.Errorf("Want %s_FILE variable %s, got %s", s.Env, want, got)
+		}
+	}
+
+	// the secret files are written when the step executes,
+	// and are not written when the stage is created.
+	for _, file := range append(ir.Files, step.Files...) {
+		if strings.HasPrefix(file.Path, dir) {
+			t.Errorf("Want secret file %s written when the step executes", file.Path)
+		}
+	}
+
+	// the secrets directory is created when the stage is
+	// created, and is owned by the runner process.
+	var protected bool
+	for _, file := range ir.Files {
+		if file.Path == filepath.Dir(dir) {
+			protected = file.IsDir && file.Protected
+		}
+	}
+	if !protected {
+		t.Errorf("Want protected secrets directory %s", filepath.Dir(dir))
+	}
+}
+
+// This test verifies that the pipeline environment is merged
+// beneath the step environment, and that the secrets referenced
+// by the pipeline environment are resolved once per stage.
+func TestCompile_Environment(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/environment.yml")
+	var requests int
+	provider := secret.StaticVars(map[string]string{
+		"docker_password": "correct-horse-battery-staple",
+	})
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Netrc = &drone.Netrc{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = findFunc(func(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+		requests++
+		return provider.Find(ctx, in)
+	})
+
+	ir, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i, want := range []string{"0", "1"} {
+		step := ir.Steps[i]
+		if got := step.Envs["GOOS"]; got != "linux" {
+			t.Errorf("Want pipeline variable GOOS for step %s, got %q", step.Name, got)
+		}
+		if got := step.Envs["CGO_ENABLED"]; got != want {
+			t.Errorf("Want CGO_ENABLED %s for step %s, got %q", want, step.Name, got)
+		}
+		want := []*engine.Secret{
+			{
+				Name: "docker_password",
+				Env:  "DOCKER_PASSWORD",
+				Data: []byte("correct-horse-battery-staple"),
+				Mask: true,
+			},
+		}
+		if diff := cmp.Diff(step.Secrets, want); len(diff) != 0 {
+			t.Errorf(diff)
+		}
+	}
+	if got, want := requests, 1; got != want {
+		t.Errorf("Want secret requested once, got %d requests", got)
 	}
 }
 
@@ -161,7 +457,11 @@ func testCompile(t *testing.T, source, golden string) *engine.Spec {
 	compiler.Netrc = &drone.Netrc{Machine: "github.com", Login: "octocat", Password: "correct-horse-battery-staple"}
 	compiler.Manifest = manifest
 	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
-	got := compiler.Compile(nocontext)
+	got, err := compiler.Compile(nocontext)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
 
 	raw, err := ioutil.ReadFile(golden)
 	if err != nil {
@@ -188,3 +488,10 @@ func dump(v interface{}) {
 	enc.SetIndent("", "  ")
 	enc.Encode(v)
 }
+
+// findFunc is a secret provider function.
+type findFunc func(context.Context, *secret.Request) (*drone.Secret, error)
+
+func (f findFunc) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	return f(ctx, in)
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingSecretsError is returned by the compiler when the
+// secrets referenced by the pipeline steps cannot be found.
+type MissingSecretsError struct {
+	Secrets []*MissingSecret
+}
+
+// MissingSecret identifies a secret that cannot be found, and
+// the pipeline step that references the secret.
+type MissingSecret struct {
+	Name string
+	Step string
+
+	// Err is the error returned by the secret provider, if
+	// any. It is nil if the secret does not exist.
+	Err error
+}
+
+// Error returns the error message.
+func (e *MissingSecretsError) Error() string {
+	var parts []string
+	for _, s := range e.Secrets {
+		part := fmt.Sprintf("%s (step %s)", s.Name, s.Step)
+		if s.Err != nil {
+			part = fmt.Sprintf("%s: %s", part, s.Err)
+		}
+		parts = append(parts, part)
+	}
+	return "cannot find secrets: " + strings.Join(parts, ", ")
+}
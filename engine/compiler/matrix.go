@@ -0,0 +1,57 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+
+	"github.com/drone/runner-go/manifest"
+)
+
+// Expand returns the pipeline steps, expanded for each
+// combination of the matrix values. Each expanded step is named
+// after the matrix values, for example `test (go=1.21)`, and its
+// dependencies are renamed to the steps of the same combination.
+// The matrix values are added to the step environment, beneath
+// the step environment variables. The pipeline steps are
+// returned unchanged if no matrix is defined.
+func Expand(pipeline *resource.Pipeline) []*resource.Step {
+	if len(pipeline.Matrix) == 0 {
+		return pipeline.Steps
+	}
+
+	names := map[string]bool{}
+	for _, step := range pipeline.Steps {
+		names[step.Name] = true
+	}
+
+	var steps []*resource.Step
+	for _, axis := range resource.Combine(pipeline.Matrix) {
+		rename := func(name string) string {
+			return resource.MatrixName(name, axis)
+		}
+		for _, src := range pipeline.Steps {
+			dst := new(resource.Step)
+			*dst = *src
+			dst.Name = rename(src.Name)
+			dst.DependsOn = nil
+			for _, dep := range src.DependsOn {
+				if names[dep] {
+					dep = rename(dep)
+				}
+				dst.DependsOn = append(dst.DependsOn, dep)
+			}
+			dst.Environment = map[string]*manifest.Variable{}
+			for _, pair := range axis {
+				dst.Environment[pair[0]] = &manifest.Variable{Value: pair[1]}
+			}
+			for k, v := range src.Environment {
+				dst.Environment[k] = v
+			}
+			steps = append(steps, dst)
+		}
+	}
+	return steps
+}
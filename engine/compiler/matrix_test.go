@@ -0,0 +1,74 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpand(t *testing.T) {
+	pipeline := &resource.Pipeline{
+		Matrix: map[string][]string{
+			"go": {"1.20", "1.21"},
+			"db": {"mysql"},
+		},
+		Steps: []*resource.Step{
+			{Name: "build", DependsOn: []string{"clone"}},
+			{Name: "test", DependsOn: []string{"build"}},
+		},
+	}
+	type step struct {
+		Name      string
+		DependsOn []string
+		Env       map[string]string
+	}
+	var got []step
+	for _, src := range Expand(pipeline) {
+		got = append(got, step{src.Name, src.DependsOn, convertStaticEnv(src.Environment)})
+	}
+	want := []step{
+		{
+			Name:      "build (db=mysql, go=1.20)",
+			DependsOn: []string{"clone"},
+			Env:       map[string]string{"db": "mysql", "go": "1.20"},
+		},
+		{
+			Name:      "test (db=mysql, go=1.20)",
+			DependsOn: []string{"build (db=mysql, go=1.20)"},
+			Env:       map[string]string{"db": "mysql", "go": "1.20"},
+		},
+		{
+			Name:      "build (db=mysql, go=1.21)",
+			DependsOn: []string{"clone"},
+			Env:       map[string]string{"db": "mysql", "go": "1.21"},
+		},
+		{
+			Name:      "test (db=mysql, go=1.21)",
+			DependsOn: []string{"build (db=mysql, go=1.21)"},
+			Env:       map[string]string{"db": "mysql", "go": "1.21"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+
+	// the source pipeline steps are not modified.
+	if got, want := pipeline.Steps[1].DependsOn[0], "build"; got != want {
+		t.Errorf("Want source step dependencies unchanged, got %s", got)
+	}
+}
+
+func TestExpand_NoMatrix(t *testing.T) {
+	pipeline := &resource.Pipeline{
+		Steps: []*resource.Step{{Name: "build"}},
+	}
+	if got := Expand(pipeline); len(got) != 1 || got[0] != pipeline.Steps[0] {
+		t.Errorf("Want pipeline steps unchanged when no matrix defined")
+	}
+}
@@ -5,12 +5,18 @@
 package compiler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
+
+	"github.com/gosimple/slug"
 )
 
 // helper function returns true if the step is configured to
@@ -45,6 +51,17 @@ func isGraph(spec *engine.Spec) bool {
 	return false
 }
 
+// helper function returns true if the pipeline steps define
+// dependencies.
+func hasDependencies(pipeline *resource.Pipeline) bool {
+	for _, step := range pipeline.Steps {
+		if len(step.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // helper function creates the dependency graph for serial
 // pipeline execution.
 func configureSerial(spec *engine.Spec) {
@@ -87,6 +104,127 @@ func convertSecretEnv(src map[string]*manifest.Variable) []*engine.Secret {
 	return dst
 }
 
+// helper function converts the readiness conditions to the
+// intermediate representation.
+func convertReady(src *resource.Ready) *engine.Ready {
+	if src == nil {
+		return nil
+	}
+	return &engine.Ready{
+		TCP:     src.TCP,
+		File:    src.File,
+		Timeout: src.Timeout,
+	}
+}
+
+// helper function converts the retry policy to the intermediate
+// representation.
+func convertRetry(src *resource.Retry) *engine.Retry {
+	if src == nil {
+		return nil
+	}
+	return &engine.Retry{
+		Attempts:  src.Attempts,
+		Delay:     src.Delay,
+		Backoff:   src.Backoff,
+		ExitCodes: src.ExitCodes,
+	}
+}
+
+// helper function converts the test reports to the intermediate
+// representation. The summary of the test results is written
+// to the reports directory, named after the step.
+func convertReports(workspace, dir, name string, src *resource.Reports) *engine.Reports {
+	if src == nil {
+		return nil
+	}
+	return &engine.Reports{
+		Dir:   workspace,
+		JUnit: src.JUnit,
+		Path:  filepath.Join(dir, name+".json"),
+	}
+}
+
+// helper function returns true if any pipeline step defines
+// test reports.
+func hasReports(pipeline *resource.Pipeline) bool {
+	for _, step := range pipeline.Steps {
+		if step.Reports != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the name of the repository cache
+// directory.
+func cacheName(repo *drone.Repo) string {
+	if repo.Slug == "" {
+		return fmt.Sprint(repo.ID)
+	}
+	return uniqueSlug(repo.Slug)
+}
+
+// helper function returns the slug of the name, suffixed with
+// a hash of the exact name. Different names may produce the
+// same slug once normalized, but not the same unique slug.
+func uniqueSlug(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return slug.Make(name) + "-" + hex.EncodeToString(sum[:8])
+}
+
+// helper function converts the workspace cache to the
+// intermediate representation. Cache paths are resolved
+// relative to the workspace, or to the home directory if
+// prefixed with a tilde.
+func convertCache(dir, home, workspace string, src *resource.Cache) *engine.Cache {
+	resolve := func(path string) string {
+		switch {
+		case path == "~":
+			return home
+		case strings.HasPrefix(path, "~/"):
+			return filepath.Join(home, path[2:])
+		default:
+			return filepath.Join(workspace, path)
+		}
+	}
+	dst := &engine.Cache{
+		Dir:   dir,
+		Key:   src.Key,
+		Roots: []string{workspace, home},
+	}
+	for _, path := range src.Hash {
+		dst.Hash = append(dst.Hash, resolve(path))
+	}
+	for _, path := range src.Paths {
+		dst.Paths = append(dst.Paths, &engine.CachePath{
+			Name: path,
+			Path: resolve(path),
+		})
+	}
+	return dst
+}
+
+// helper function merges the default resource limits with the
+// pipeline resource limits. The pipeline limits are applied
+// only if lower than the default limits.
+func convertLimits(defaults engine.Limits, src resource.Limits) *engine.Limits {
+	dst := defaults
+	if v := int64(src.Memory); v > 0 && (dst.Memory == 0 || v < dst.Memory) {
+		dst.Memory = v
+	}
+	if v := src.CPU; v > 0 && (dst.CPU == 0 || v < dst.CPU) {
+		dst.CPU = v
+	}
+	if v := src.Pids; v > 0 && (dst.Pids == 0 || v < dst.Pids) {
+		dst.Pids = v
+	}
+	if dst == (engine.Limits{}) {
+		return nil
+	}
+	return &dst
+}
+
 // helper function modifies the pipeline dependency graph to
 // account for the clone step.
 func configureCloneDeps(spec *engine.Spec) {
@@ -115,3 +253,35 @@ func removeCloneDeps(spec *engine.Spec) {
 		}
 	}
 }
+
+// helper function configures the masked secrets of the step to
+// be written to files in the secrets directory, and exports the
+// file paths to the step environment. The files are written by
+// the engine when the step executes, in a directory unique to
+// the step.
+func configureSecretFiles(spec *engine.Spec, step *engine.Step) {
+	dir := filepath.Join(spec.Root, "opt", "secrets", uniqueSlug(step.Name))
+	for _, s := range step.Secrets {
+		if s.Mask == false {
+			continue
+		}
+		s.File = filepath.Join(dir, s.Env)
+		step.Envs[s.Env+"_FILE"] = s.File
+	}
+}
+
+// helper function returns the step environment variables merged
+// over the pipeline environment variables.
+func mergeEnv(pipeline, step map[string]*manifest.Variable) map[string]*manifest.Variable {
+	if len(pipeline) == 0 {
+		return step
+	}
+	dst := map[string]*manifest.Variable{}
+	for k, v := range pipeline {
+		dst[k] = v
+	}
+	for k, v := range step {
+		dst[k] = v
+	}
+	return dst
+}
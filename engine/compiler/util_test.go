@@ -5,10 +5,12 @@
 package compiler
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 
 	"github.com/google/go-cmp/cmp"
@@ -119,6 +121,83 @@ func Test_convertSecretEnv(t *testing.T) {
 	}
 }
 
+func Test_convertReady(t *testing.T) {
+	if convertReady(nil) != nil {
+		t.Errorf("Expect nil readiness conditions")
+	}
+	got := convertReady(&resource.Ready{
+		TCP:  "localhost:5432",
+		File: "/tmp/ready",
+	})
+	want := &engine.Ready{
+		TCP:  "localhost:5432",
+		File: "/tmp/ready",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected readiness conditions")
+		t.Log(diff)
+	}
+}
+
+func Test_convertLimits(t *testing.T) {
+	if convertLimits(engine.Limits{}, resource.Limits{}) != nil {
+		t.Errorf("Expect nil limits when no limits defined")
+	}
+
+	defaults := engine.Limits{Memory: 2048, CPU: 2}
+	got := convertLimits(defaults, resource.Limits{
+		Memory: 1024,
+		CPU:    4,
+		Pids:   100,
+	})
+	want := &engine.Limits{
+		Memory: 1024, // lower than default
+		CPU:    2,    // cannot exceed default
+		Pids:   100,  // no default
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected resource limits")
+		t.Log(diff)
+	}
+}
+
+func Test_convertCache(t *testing.T) {
+	src := &resource.Cache{
+		Key:   "deps",
+		Hash:  []string{"go.sum"},
+		Paths: []string{"node_modules", "~/go/pkg/mod"},
+	}
+	got := convertCache("/tmp/drone-cache/octocat-hello-world", "/tmp/drone-random/home/drone", "/tmp/drone-random/drone/src", src)
+	want := &engine.Cache{
+		Dir:  "/tmp/drone-cache/octocat-hello-world",
+		Key:  "deps",
+		Hash: []string{"/tmp/drone-random/drone/src/go.sum"},
+		Paths: []*engine.CachePath{
+			{Name: "node_modules", Path: "/tmp/drone-random/drone/src/node_modules"},
+			{Name: "~/go/pkg/mod", Path: "/tmp/drone-random/home/drone/go/pkg/mod"},
+		},
+		Roots: []string{"/tmp/drone-random/drone/src", "/tmp/drone-random/home/drone"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected cache configuration")
+		t.Log(diff)
+	}
+}
+
+func Test_cacheName(t *testing.T) {
+	a := cacheName(&drone.Repo{Slug: "a/b-c"})
+	b := cacheName(&drone.Repo{Slug: "a-b/c"})
+	if a == b {
+		t.Errorf("Want unique cache name for each repository, got %s", a)
+	}
+	if !strings.HasPrefix(a, "a-b-c-") {
+		t.Errorf("Want cache name prefixed with the repository slug, got %s", a)
+	}
+	if got, want := cacheName(&drone.Repo{ID: 42}), "42"; got != want {
+		t.Errorf("Want cache name %s, got %s", want, got)
+	}
+}
+
 func Test_configureCloneDeps(t *testing.T) {
 	before := new(engine.Spec)
 	before.Steps = []*engine.Step{
@@ -0,0 +1,61 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/drone/runner-go/environ"
+)
+
+// Shell opens an interactive shell in the working directory of
+// the pipeline step, with the step environment and secrets, and
+// blocks until the shell exits. The shell executes as the
+// pipeline user, outside of the sandbox, and is attached to the
+// standard input and output of the runner process.
+func Shell(ctx context.Context, spec *Spec, step *Step) (*State, error) {
+	command, args := interactiveShell(step)
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = environ.Slice(step.Envs)
+	cmd.Dir = step.WorkingDir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	for _, secret := range step.Secrets {
+		if secret.File != "" {
+			continue
+		}
+		s := fmt.Sprintf("%s=%s", secret.Env, string(secret.Data))
+		cmd.Env = append(cmd.Env, s)
+	}
+
+	cleanup, err := writeSecretFiles(spec, step)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	// the shell does not execute in a new process group, since
+	// it must remain in the foreground to read from the terminal.
+	if err := setCredential(cmd, spec); err != nil {
+		return nil, err
+	}
+
+	err = cmd.Run()
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		return &State{
+			ExitCode: exiterr.ExitCode(),
+			Exited:   true,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &State{ExitCode: 0, Exited: true}, nil
+}
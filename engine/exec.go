@@ -6,22 +6,62 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/janitor"
 
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/logger"
 )
 
+// ErrTimeout is returned when a step exceeds its configured
+// timeout and is killed.
+var ErrTimeout = errors.New("step timed out")
+
+// DefaultGracePeriod is the default amount of time a step is
+// given to exit after receiving the terminate signal, before it
+// is forcibly killed.
+const DefaultGracePeriod = 10 * time.Second
+
+// waitTimeout is the amount of time to wait for a killed step
+// to exit and flush its output.
+const waitTimeout = 5 * time.Second
+
+// Opts configures the engine.
+type Opts struct {
+	// GracePeriod defines the amount of time the step process
+	// group is given to exit after receiving the terminate
+	// signal, before it is forcibly killed.
+	GracePeriod time.Duration
+
+	// Cgroup defines the optional cgroup v2 path in which the
+	// step cgroups are created to enforce the pipeline resource
+	// limits. Resource limits are not enforced if empty.
+	Cgroup string
+}
+
 // New returns a new engine.
-func New() Engine {
-	return new(engine)
+func New(opts Opts) Engine {
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = DefaultGracePeriod
+	}
+	return &engine{
+		grace:  opts.GracePeriod,
+		cgroup: opts.Cgroup,
+	}
 }
 
-type engine struct{}
+type engine struct {
+	grace  time.Duration
+	cgroup string
+}
 
 // Setup the pipeline environment.
 func (e *engine) Setup(ctx context.Context, spec *Spec) error {
@@ -30,12 +70,35 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		return err
 	}
 
+	// the stage root remains owned by the runner process, and
+	// must be accessible to the pipeline user.
+	if spec.User != "" {
+		if err := os.Chmod(spec.Root, 0755); err != nil {
+			return err
+		}
+	}
+
+	// the marker file identifies the stage root as owned by the
+	// current process, so that the root is removed by the
+	// janitor if the process exits before the stage completes.
+	err = janitor.Mark(spec.Root)
+	if err != nil {
+		return err
+	}
+
 	// creates folders
 	for _, file := range spec.Files {
 		if file.IsDir == false {
 			continue
 		}
-		err = os.MkdirAll(file.Path, 0700)
+		mode := os.FileMode(0700)
+		if file.Protected {
+			mode = os.FileMode(file.Mode)
+		}
+		err = os.MkdirAll(file.Path, mode)
+		if err == nil {
+			err = os.Chmod(file.Path, mode)
+		}
 		if err != nil {
 			logger.FromContext(ctx).
 				WithError(err).
@@ -86,54 +149,153 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		}
 	}
 
+	// change the owner of the workspace to the pipeline user,
+	// if defined.
+	if err := chownRoot(spec); err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			WithField("user", spec.User).
+			WithField("group", spec.Group).
+			Error("cannot change workspace owner")
+		return err
+	}
+
 	return nil
 }
 
 // Destroy the pipeline environment.
 func (e *engine) Destroy(ctx context.Context, spec *Spec) error {
+	if err := destroyCgroup(e.cgroup, spec); err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Debug("cannot remove stage cgroup")
+	}
 	return os.RemoveAll(spec.Root)
 }
 
 // Run runs the pipeline step.
 func (e *engine) Run(ctx context.Context, spec *Spec, step *Step, output io.Writer) (*State, error) {
-	cmd := exec.CommandContext(ctx, step.Command, step.Args...)
+	cmd := exec.Command(step.Command, step.Args...)
 	cmd.Env = environ.Slice(step.Envs)
 	cmd.Dir = step.WorkingDir
 	cmd.Stdout = output
 	cmd.Stderr = output
 
 	for _, secret := range step.Secrets {
+		if secret.File != "" {
+			continue
+		}
 		s := fmt.Sprintf("%s=%s", secret.Env, string(secret.Data))
 		cmd.Env = append(cmd.Env, s)
 	}
 
-	err := cmd.Start()
+	// the secret files are written immediately before the step
+	// executes, and are removed when the step exits.
+	cleanup, err := writeSecretFiles(spec, step)
 	if err != nil {
 		return nil, err
 	}
+	defer cleanup()
+
+	// the step runs in its own process group so that background
+	// processes spawned by the step are terminated with the step.
+	setProcessGroup(cmd)
+
+	// the step executes as the pipeline user, if defined. If
+	// the pipeline executes in the sandbox, the sandbox init
+	// process is responsible for changing the user.
+	if spec.Sandbox {
+		if err := sandbox(cmd, spec); err != nil {
+			return nil, err
+		}
+	} else if err := setCredential(cmd, spec); err != nil {
+		return nil, err
+	}
+
+	// the step resource limits are enforced using a cgroup. If
+	// the cgroup cannot be created the step executes without
+	// resource limits. The process is started in the cgroup,
+	// so that its descendants cannot escape the limits.
+	cg, err := createCgroup(e.cgroup, spec, step)
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Warn("cannot create cgroup, resource limits are not enforced")
+	}
+	if cg != nil {
+		f, err := cg.attach(cmd)
+		if err != nil {
+			cg.destroy()
+			return nil, err
+		}
+		if f != nil {
+			defer f.Close()
+		}
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		if cg != nil {
+			cg.destroy()
+			err = fmt.Errorf("cannot start process in cgroup: %s", err)
+		}
+		return nil, err
+	}
 
 	log := logger.FromContext(ctx)
 	log = log.WithField("process.pid", cmd.Process.Pid)
 	log.Debug("process started")
 
-	done := make(chan error)
+	if err := attachProcessGroup(cmd); err != nil {
+		log.WithError(err).
+			Warn("cannot attach process group, descendant processes may outlive the step")
+	}
+	defer releaseProcessGroup(cmd)
+
+	if cg != nil {
+		defer cg.destroy()
+		if err := cg.join(cmd); err != nil {
+			log.WithError(err).
+				Warn("cannot move process into cgroup, resource limits are not enforced")
+		}
+	}
+
+	done := make(chan error, 1)
 	go func() {
 		done <- cmd.Wait()
 	}()
 
+	// the step timeout is tracked separately from the parent
+	// context so that an expired step can be distinguished from
+	// a cancelled or expired stage.
+	var timeout <-chan time.Time
+	if step.Timeout > 0 {
+		timer := time.NewTimer(step.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
 	select {
 	case err = <-done:
 	case <-ctx.Done():
-		cmd.Process.Kill()
+		e.kill(ctx, cmd)
+		wait(done)
 
 		log.Debug("process killed")
 		return nil, ctx.Err()
+	case <-timeout:
+		e.kill(ctx, cmd)
+		wait(done)
+
+		log.WithField("process.timeout", step.Timeout).
+			Debug("process killed, timeout exceeded")
+		return nil, ErrTimeout
 	}
 
 	state := &State{
 		ExitCode:  0,
 		Exited:    true,
-		OOMKilled: false,
+		OOMKilled: cg != nil && cg.oomKilled(),
 	}
 	if err != nil {
 		state.ExitCode = 255
@@ -147,6 +309,81 @@ func (e *engine) Run(ctx context.Context, spec *Spec, step *Step, output io.Writ
 	return state, err
 }
 
+// Chown changes the owner of the named path, and all of its
+// contents, to the pipeline user and group, if defined.
+func Chown(spec *Spec, path string) error {
+	return chown(spec, path)
+}
+
+// helper function changes the owner of the stage root contents
+// to the pipeline user and group, if defined. The stage root
+// and the protected directories remain owned by the runner
+// process, so that the pipeline steps cannot replace the files
+// the runner writes to the directories. The files in protected
+// directories are changed.
+func chownRoot(spec *Spec) error {
+	if spec.User == "" {
+		return nil
+	}
+	protected := map[string]bool{spec.Root: true}
+	for _, file := range spec.Files {
+		if file.IsDir && file.Protected {
+			protected[file.Path] = true
+		}
+	}
+	return filepath.Walk(spec.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if protected[path] {
+			return nil
+		}
+		if err := chown(spec, path); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// helper function terminates the step process group. The
+// process group is sent the terminate signal, and is killed if
+// any process is still running after the grace period.
+func (e *engine) kill(ctx context.Context, cmd *exec.Cmd) {
+	log := logger.FromContext(ctx).
+		WithField("process.pid", cmd.Process.Pid)
+
+	if err := terminate(cmd); err != nil {
+		log.WithError(err).
+			Trace("cannot terminate process group")
+	}
+
+	deadline := time.Now().Add(e.grace)
+	for running(cmd) && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := kill(cmd); err != nil {
+		log.WithError(err).
+			Trace("cannot kill process group")
+	}
+}
+
+// helper function waits for the killed process to exit, so
+// that its output is written before the step returns and the
+// output stream is closed. The wait is bounded in case a
+// process outside the process group holds the output open.
+func wait(done <-chan error) {
+	timer := time.NewTimer(waitTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
+
 type nilReader struct{}
 
 func (*nilReader) Read(p []byte) (n int, err error) {
@@ -176,3 +413,69 @@ func (e *engine) Wait(context.Context, *Spec, *Step) (*State, error) {
 func (e *engine) Tail(context.Context, *Spec, *Step) (io.ReadCloser, error) {
 	return nil, nil // no-op for bash implementation
 }
+
+// helper function writes the secret files of the step, readable
+// only by the pipeline user, and returns a function that removes
+// the files. The files are written when the step executes, so
+// that the secrets of a step are not readable by other steps,
+// and are not left behind in kept workspaces.
+//
+// The secret files are written to a step directory owned by the
+// runner process, in the protected secrets directory, so that
+// the pipeline steps cannot replace the directory or the files
+// with symbolic links. Only the files and directories created
+// by the function are removed.
+func writeSecretFiles(spec *Spec, step *Step) (func(), error) {
+	var created []string
+	cleanup := func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			os.Remove(created[i])
+		}
+	}
+	for _, secret := range step.Secrets {
+		if secret.File == "" {
+			continue
+		}
+		dir := filepath.Dir(secret.File)
+		if !contains(created, dir) {
+			// the secrets directory is created when the stage is
+			// created, unless the step executes without setup.
+			if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+				cleanup()
+				return nil, err
+			}
+			if err := os.Mkdir(dir, 0755); err != nil {
+				cleanup()
+				return nil, err
+			}
+			created = append(created, dir)
+		}
+		f, err := createFile(secret.File, 0600)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		created = append(created, secret.File)
+		_, err = f.Write(secret.Data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = chown(spec, secret.File)
+		}
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	return cleanup, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// This test verifies that background processes spawned by the
+// step are terminated when the step is cancelled.
+func TestRun_CancelKillsDescendants(t *testing.T) {
+	testKillDescendants(t, "")
+}
+
+// This test verifies that background processes that ignore the
+// terminate signal are killed once the grace period expires.
+func TestRun_CancelKillsDescendantsIgnoringTerm(t *testing.T) {
+	testKillDescendants(t, "trap '' TERM;")
+}
+
+func testKillDescendants(t *testing.T, prefix string) {
+	dir := t.TempDir()
+	pidfile := filepath.Join(dir, "pid")
+
+	script := fmt.Sprintf("%s sleep 60 & echo $! > %s; sleep 60", prefix, pidfile)
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", script},
+		WorkingDir: dir,
+	}
+
+	ctx, cancel := context.WithCancel(nocontext)
+	go func() {
+		for {
+			if _, err := ioutil.ReadFile(pidfile); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	engine := New(Opts{GracePeriod: 500 * time.Millisecond})
+	_, err := engine.Run(ctx, new(Spec), step, ioutil.Discard)
+	if err != context.Canceled {
+		t.Errorf("Want context cancelled error, got %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the killed process may not be reaped immediately, so we
+	// poll the process table until the process is gone.
+	deadline := time.Now().Add(5 * time.Second)
+	for alive(pid) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if alive(pid) {
+		t.Errorf("Want descendant process %d killed", pid)
+	}
+}
+
+// helper function returns true if the process exists and is
+// not a zombie.
+func alive(pid int) bool {
+	raw, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// the process state follows the parenthesized command
+	// name in the stat file.
+	stat := string(raw)
+	if i := strings.LastIndex(stat, ")"); i != -1 && i+2 < len(stat) {
+		return stat[i+2] != 'Z'
+	}
+	return true
+}
@@ -2,4 +2,95 @@
 // Use of this source code is governed by the Polyform License
 // that can be found in the LICENSE file.
 
+// +build !windows
+
 package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+var nocontext = context.Background()
+
+// This test verifies that a step is killed and the timeout
+// error is returned when the step exceeds its timeout.
+func TestRun_Timeout(t *testing.T) {
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "sleep 10"},
+		Timeout:    100 * time.Millisecond,
+		WorkingDir: t.TempDir(),
+	}
+	start := time.Now()
+	state, err := New(Opts{}).Run(nocontext, new(Spec), step, ioutil.Discard)
+	if err != ErrTimeout {
+		t.Errorf("Want timeout error, got %v", err)
+	}
+	if state != nil {
+		t.Errorf("Want nil state when step times out")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Want step killed when timeout exceeded")
+	}
+}
+
+// This test verifies that a step that completes before its
+// timeout returns the exit code.
+func TestRun_TimeoutNotExceeded(t *testing.T) {
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "exit 2"},
+		Timeout:    time.Minute,
+		WorkingDir: t.TempDir(),
+	}
+	state, _ := New(Opts{}).Run(nocontext, new(Spec), step, ioutil.Discard)
+	if state == nil {
+		t.Errorf("Want state when step completes")
+		return
+	}
+	if got, want := state.ExitCode, 2; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+}
+
+// This test verifies that a cancelled context returns the
+// context error rather than the timeout error.
+func TestRun_Cancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(nocontext, 100*time.Millisecond)
+	defer cancel()
+
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "sleep 10"},
+		Timeout:    time.Minute,
+		WorkingDir: t.TempDir(),
+	}
+	_, err := New(Opts{}).Run(ctx, new(Spec), step, ioutil.Discard)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want context error, got %v", err)
+	}
+}
+
+// This test verifies that the output written by a step while
+// it is being killed is written before the step returns.
+func TestRun_TimeoutFlushesOutput(t *testing.T) {
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "trap 'sleep 0.2; echo terminated; exit 1' TERM; sleep 10 & wait"},
+		Timeout:    100 * time.Millisecond,
+		WorkingDir: t.TempDir(),
+	}
+	var buf bytes.Buffer
+	_, err := New(Opts{GracePeriod: 5 * time.Second}).Run(nocontext, new(Spec), step, &buf)
+	if err != ErrTimeout {
+		t.Errorf("Want timeout error, got %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "terminated") {
+		t.Errorf("Want output written before the step returns, got %q", got)
+	}
+}
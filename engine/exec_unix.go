@@ -0,0 +1,156 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// helper function configures the command to start in a new
+// process group, so that the step and all of its descendants
+// can be signaled together.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// helper function is a no-op on unix, where the process group
+// is created when the process starts.
+func attachProcessGroup(cmd *exec.Cmd) error { return nil }
+
+// helper function is a no-op on unix, where the process group
+// does not hold any resources.
+func releaseProcessGroup(cmd *exec.Cmd) {}
+
+// helper function sends the terminate signal to the process
+// group.
+func terminate(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// helper function sends the kill signal to the process group.
+func kill(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// helper function returns true if any process in the process
+// group is still running.
+func running(cmd *exec.Cmd) bool {
+	return syscall.Kill(-cmd.Process.Pid, 0) == nil
+}
+
+// helper function creates the named file for writing. The file
+// must not exist, and is not created if the name is a symbolic
+// link.
+func createFile(name string, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, perm)
+}
+
+// helper function configures the command to execute as the
+// pipeline user and group, if defined.
+func setCredential(cmd *exec.Cmd, spec *Spec) error {
+	if spec.User == "" {
+		return nil
+	}
+	cred, err := lookupCredential(spec.User, spec.Group)
+	if err != nil {
+		return err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Credential = cred
+	return nil
+}
+
+// helper function changes the owner of the named path, and all
+// of its contents, to the pipeline user and group, if defined.
+func chown(spec *Spec, root string) error {
+	if spec.User == "" {
+		return nil
+	}
+	cred, err := lookupCredential(spec.User, spec.Group)
+	if err != nil {
+		return err
+	}
+	uid, gid := int(cred.Uid), int(cred.Gid)
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// helper function returns the credentials of the named user
+// and group. The user and group may be defined by name or by
+// numeric identifier. If the group is empty, the primary group
+// of the user is used.
+func lookupCredential(username, groupname string) (*syscall.Credential, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		if _, ok := err.(user.UnknownUserError); !ok {
+			return nil, err
+		}
+		if u, err = user.LookupId(username); err != nil {
+			return nil, err
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	gidstr := u.Gid
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			if _, ok := err.(user.UnknownGroupError); !ok {
+				return nil, err
+			}
+			if g, err = user.LookupGroupId(groupname); err != nil {
+				return nil, err
+			}
+		}
+		gidstr = g.Gid
+	}
+	gid, err := strconv.ParseUint(gidstr, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &syscall.Credential{
+		Uid: uint32(uid),
+		Gid: uint32(gid),
+	}
+
+	// the supplementary groups are optional, and may not be
+	// available on all systems.
+	ids, _ := u.GroupIds()
+	for _, id := range ids {
+		if v, err := strconv.ParseUint(id, 10, 32); err == nil {
+			cred.Groups = append(cred.Groups, uint32(v))
+		}
+	}
+	return cred, nil
+}
+
+// helper function returns the interactive shell used to debug
+// a pipeline step, which defaults to the user shell.
+func interactiveShell(step *Step) (string, []string) {
+	if shell := step.Envs["SHELL"]; shell != "" {
+		return shell, nil
+	}
+	return "/bin/sh", nil
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLookupCredential(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, name := range []string{u.Username, u.Uid} {
+		cred, err := lookupCredential(name, "")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, want := fmt.Sprint(cred.Uid), u.Uid; got != want {
+			t.Errorf("Want uid %s, got %s", want, got)
+		}
+		if got, want := fmt.Sprint(cred.Gid), u.Gid; got != want {
+			t.Errorf("Want primary gid %s, got %s", want, got)
+		}
+	}
+
+	cred, err := lookupCredential(u.Username, u.Gid)
+	if err != nil {
+		t.Error(err)
+	} else if got, want := fmt.Sprint(cred.Gid), u.Gid; got != want {
+		t.Errorf("Want gid %s, got %s", want, got)
+	}
+
+	if _, err := lookupCredential("this-user-does-not-exist", ""); err == nil {
+		t.Errorf("Want error when user does not exist")
+	}
+}
+
+// This test verifies that the pipeline workspace is owned by
+// the pipeline user, and that steps execute as the pipeline
+// user.
+func TestRun_User(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	spec := &Spec{
+		Root: t.TempDir(),
+		User: u.Username,
+	}
+	engine := New(Opts{})
+	if err := engine.Setup(nocontext, spec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "id -u"},
+		WorkingDir: spec.Root,
+	}
+	if _, err := engine.Run(nocontext, spec, step, buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := strings.TrimSpace(buf.String()), fmt.Sprint(os.Getuid()); got != want {
+		t.Errorf("Want step executed as uid %s, got %s", want, got)
+	}
+}
+
+// This test verifies that the setup fails if the pipeline user
+// does not exist.
+func TestSetup_UnknownUser(t *testing.T) {
+	spec := &Spec{
+		Root: t.TempDir(),
+		User: "this-user-does-not-exist",
+	}
+	if err := New(Opts{}).Setup(nocontext, spec); err == nil {
+		t.Errorf("Want error when pipeline user does not exist")
+	}
+}
+
+// This test verifies that steps drop privileges to the pipeline
+// user. It requires the tests to execute as root.
+func TestRun_UserUnprivileged(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// the test directory is not accessible to other users, so
+	// the root is created in the shared temporary directory.
+	root, err := ioutil.TempDir("", "drone-")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(root)
+
+	workspace := filepath.Join(root, "drone", "src")
+	spec := &Spec{
+		Root: root,
+		User: u.Username,
+		Files: []*File{
+			{Path: workspace, IsDir: true},
+		},
+	}
+	engine := New(Opts{})
+	if err := engine.Setup(nocontext, spec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "id -u; touch owned"},
+		WorkingDir: workspace,
+	}
+	state, err := engine.Run(nocontext, spec, step, buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if state.ExitCode != 0 {
+		t.Errorf("Want step can write to the workspace, got %s", buf.String())
+	}
+	if got, want := strings.Split(buf.String(), "\n")[0], u.Uid; got != want {
+		t.Errorf("Want step executed as uid %s, got %s", want, got)
+	}
+}
+
+// This test verifies that the stage root and the protected
+// directories remain owned by the runner process. It requires
+// the tests to execute as root.
+func TestSetup_Protected(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip(err)
+	}
+	root := t.TempDir()
+	spec := &Spec{
+		Root: root,
+		User: u.Username,
+		Files: []*File{
+			{Path: filepath.Join(root, "drone", "src"), IsDir: true},
+			{Path: filepath.Join(root, "opt"), Mode: 0755, IsDir: true, Protected: true},
+			{Path: filepath.Join(root, "opt", "build.sh"), Mode: 0700},
+		},
+	}
+	if err := New(Opts{}).Setup(nocontext, spec); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		root:                                   "0",
+		filepath.Join(root, "opt"):             "0",
+		filepath.Join(root, "opt", "build.sh"): u.Uid,
+		filepath.Join(root, "drone"):           u.Uid,
+		filepath.Join(root, "drone", "src"):    u.Uid,
+	}
+	for path, want := range tests {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		uid := info.Sys().(*syscall.Stat_t).Uid
+		if got := strconv.Itoa(int(uid)); got != want {
+			t.Errorf("Want %s owned by uid %s, got %s", path, want, got)
+		}
+	}
+}
+
+// This test verifies that the debug shell exit code is
+// returned, and that the shell defaults to the user shell.
+func TestShell(t *testing.T) {
+	for shell, want := range map[string]int{"/bin/true": 0, "/bin/false": 1} {
+		step := &Step{
+			Envs:       map[string]string{"SHELL": shell},
+			WorkingDir: os.TempDir(),
+		}
+		state, err := Shell(nocontext, &Spec{}, step)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := state.ExitCode; got != want {
+			t.Errorf("Want exit code %d for shell %s, got %d", want, shell, got)
+		}
+	}
+}
+
+// This test verifies that a secret delivered as a file is not
+// exported to the step environment, and that the file is
+// written when the step executes, and removed when it exits.
+func TestRun_SecretFile(t *testing.T) {
+	spec := &Spec{Root: t.TempDir()}
+	dir := filepath.Join(spec.Root, "opt", "secrets", "build")
+	file := filepath.Join(dir, "PASSWORD")
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "echo ${USERNAME:-unset} ${PASSWORD:-unset} $(cat " + file + ") $(ls -ld " + dir + " " + file + " | cut -c1-10)"},
+		Secrets: []*Secret{
+			{Name: "username", Env: "USERNAME", Data: []byte("octocat")},
+			{Name: "password", Env: "PASSWORD", Data: []byte("correct-horse-battery-staple"), Mask: true, File: file},
+		},
+		WorkingDir: spec.Root,
+	}
+	if _, err := New(Opts{}).Run(nocontext, spec, step, buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := strings.TrimSpace(buf.String()), "octocat unset correct-horse-battery-staple drwxr-xr-x -rw-------"; got != want {
+		t.Errorf("Want secret file readable only by the step, got %q", got)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Want secret files removed when the step exits")
+	}
+}
+
+// This test verifies that the secret files are not written to
+// an existing step directory, and that files the runner did not
+// create are not removed.
+func TestRun_SecretFileExists(t *testing.T) {
+	spec := &Spec{Root: t.TempDir()}
+	dir := filepath.Join(spec.Root, "opt", "secrets", "build")
+	target := filepath.Join(t.TempDir(), "crontab")
+	os.MkdirAll(dir, 0755)
+	os.Symlink(target, filepath.Join(dir, "PASSWORD"))
+
+	step := &Step{
+		Command: "/bin/true",
+		Secrets: []*Secret{
+			{Name: "password", Env: "PASSWORD", Data: []byte("correct-horse-battery-staple"), Mask: true, File: filepath.Join(dir, "PASSWORD")},
+		},
+		WorkingDir: spec.Root,
+	}
+	if _, err := New(Opts{}).Run(nocontext, spec, step, ioutil.Discard); err == nil {
+		t.Errorf("Want error when the step directory exists")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "PASSWORD")); err != nil {
+		t.Errorf("Want existing files not removed, got %s", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Want secret not written through a symbolic link")
+	}
+}
+
+// This test verifies that a file is not created through a
+// symbolic link.
+func TestCreateFile_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "crontab")
+	os.Symlink(target, filepath.Join(dir, "PASSWORD"))
+	if f, err := createFile(filepath.Join(dir, "PASSWORD"), 0600); err == nil {
+		f.Close()
+		t.Errorf("Want error creating a file through a symbolic link")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Want symbolic link target not created")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// errUserNotSupported is returned when a pipeline user is
+// defined on windows.
+var errUserNotSupported = errors.New("pipeline user is not supported on windows")
+
+// jobs maps a running command to the job object that contains
+// the step process and all of its descendants.
+var jobs sync.Map
+
+// helper function is a no-op on windows. The process is
+// assigned to a job object once it starts.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// helper function assigns the started process to a new job
+// object, so that the step and all of its descendants can be
+// terminated together. The job is configured to kill any
+// remaining process when the job handle is closed.
+//
+// The process is assigned after it starts, so a descendant
+// spawned before the assignment is not part of the job.
+func attachProcessGroup(cmd *exec.Cmd) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return err
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	_, err = windows.SetInformationJobObject(
+		job,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+	)
+	if err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	process, err := windows.OpenProcess(
+		windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE,
+		false,
+		uint32(cmd.Process.Pid),
+	)
+	if err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	defer windows.CloseHandle(process)
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	jobs.Store(cmd, job)
+	return nil
+}
+
+// helper function closes the job object, which kills any
+// process in the job that is still running.
+func releaseProcessGroup(cmd *exec.Cmd) {
+	if job, ok := jobs.LoadAndDelete(cmd); ok {
+		windows.CloseHandle(job.(windows.Handle))
+	}
+}
+
+// helper function kills the process group. windows does not
+// support the terminate signal.
+func terminate(cmd *exec.Cmd) error {
+	return kill(cmd)
+}
+
+// helper function terminates the job object, which kills the
+// process and all of its descendants. If the process is not
+// assigned to a job object, only the process is killed.
+func kill(cmd *exec.Cmd) error {
+	if job, ok := jobs.Load(cmd); ok {
+		return windows.TerminateJobObject(job.(windows.Handle), 1)
+	}
+	return cmd.Process.Kill()
+}
+
+// helper function returns false because the process group is
+// killed immediately on windows.
+func running(cmd *exec.Cmd) bool {
+	return false
+}
+
+// helper function creates the named file for writing. The file
+// must not exist, which includes a symbolic link.
+func createFile(name string, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+}
+
+// helper function returns an error if the pipeline user is
+// defined, which is not supported on windows.
+func setCredential(cmd *exec.Cmd, spec *Spec) error {
+	if spec.User != "" {
+		return errUserNotSupported
+	}
+	return nil
+}
+
+// helper function returns an error if the pipeline user is
+// defined, which is not supported on windows.
+func chown(spec *Spec, root string) error {
+	if spec.User != "" {
+		return errUserNotSupported
+	}
+	return nil
+}
+
+// helper function returns the interactive shell used to debug
+// a pipeline step.
+func interactiveShell(step *Step) (string, []string) {
+	return "powershell", []string{"-NoLogo"}
+}
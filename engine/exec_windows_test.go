@@ -0,0 +1,58 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// This test verifies that descendant processes spawned by the
+// step are killed when the step is killed.
+func TestRun_KillDescendants(t *testing.T) {
+	dir := t.TempDir()
+	step := &Step{
+		Command: "powershell",
+		Args: []string{
+			"-NoProfile",
+			"-Command",
+			"$p = Start-Process -PassThru -WindowStyle Hidden ping -ArgumentList '-n','60','127.0.0.1'; " +
+				"Set-Content -Path pid -Value $p.Id; Start-Sleep -Seconds 60",
+		},
+		Timeout:    5 * time.Second,
+		WorkingDir: dir,
+	}
+	_, err := New(Opts{}).Run(context.Background(), new(Spec), step, ioutil.Discard)
+	if err != ErrTimeout {
+		t.Errorf("Want timeout error, got %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	process, err := windows.OpenProcess(windows.SYNCHRONIZE, false, uint32(pid))
+	if err != nil {
+		return // the process no longer exists
+	}
+	defer windows.CloseHandle(process)
+	event, _ := windows.WaitForSingleObject(process, 5000)
+	if event != windows.WAIT_OBJECT_0 {
+		t.Errorf("Want descendant process killed with the step")
+	}
+}
@@ -7,50 +7,236 @@
 package replacer
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 )
 
 const maskedf = "[secret:%s]"
 
+// minLineLength is the minimum length of a line of a multi-line
+// secret that is masked on its own. Shorter lines, such as the
+// braces of a json document, are common in the logs.
+const minLineLength = 8
+
 // Replacer is an io.Writer that finds and masks sensitive data.
+// The replacer holds back the end of the stream that may be the
+// start of a secret, so that a secret split across writes is
+// masked. The held back data is written when the replacer is
+// closed.
 type Replacer struct {
-	w io.WriteCloser
-	r *strings.Replacer
+	mu   sync.Mutex
+	w    io.WriteCloser
+	trie *node
+	buf  []byte
+}
+
+// node is a node in the trie of sensitive values. The mask is
+// defined if a sensitive value ends at the node.
+type node struct {
+	next map[byte]*node
+	mask []byte
 }
 
 // New returns a replacer that wraps writer w.
 func New(w io.WriteCloser, secrets []*engine.Secret) io.WriteCloser {
-	var oldnew []string
+	trie := &node{next: map[byte]*node{}}
 	for _, secret := range secrets {
 		if len(secret.Data) == 0 || secret.Mask == false {
 			continue
 		}
 		name := strings.ToLower(secret.Name)
-		masked := fmt.Sprintf(maskedf, name)
-		oldnew = append(oldnew, string(secret.Data))
-		oldnew = append(oldnew, masked)
+		masked := []byte(fmt.Sprintf(maskedf, name))
+		for _, value := range variants(string(secret.Data)) {
+			trie.insert(value, masked)
+		}
 	}
-	if len(oldnew) == 0 {
+	if len(trie.next) == 0 {
 		return w
 	}
 	return &Replacer{
-		w: w,
-		r: strings.NewReplacer(oldnew...),
+		w:    w,
+		trie: trie,
 	}
 }
 
 // Write writes p to the base writer. The method scans for any
 // sensitive data in p and masks before writing.
 func (r *Replacer) Write(p []byte) (n int, err error) {
-	_, err = r.w.Write([]byte(r.r.Replace(string(p))))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, p...)
+	if out := r.replace(false); len(out) != 0 {
+		_, err = r.w.Write(out)
+	}
 	return len(p), err
 }
 
-// Close closes the base writer.
+// Close writes the held back data and closes the base writer.
 func (r *Replacer) Close() error {
-	return r.w.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	if out := r.replace(true); len(out) != 0 {
+		_, err = r.w.Write(out)
+	}
+	if cerr := r.w.Close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// replace masks the longest sensitive value at each position of
+// the buffer and returns the masked data. Terminal escape
+// sequences inside a sensitive value are masked with the value.
+// Unless flushing, the end of the buffer that may be the start
+// of a sensitive value is held back.
+func (r *Replacer) replace(flush bool) []byte {
+	var out bytes.Buffer
+	i := 0
+	for i < len(r.buf) {
+		var mask []byte
+		var size int
+		var partial bool
+		n := r.trie
+		for j := i; ; j++ {
+			if j == len(r.buf) {
+				// a sensitive value may continue in the next
+				// write.
+				partial = len(n.next) != 0
+				break
+			}
+			next := n.next[r.buf[j]]
+			if next == nil && j > i {
+				// terminal escape sequences, such as color
+				// codes, inside a sensitive value are skipped.
+				size, ok := escape(r.buf[j:])
+				if size != 0 {
+					j += size - 1
+					continue
+				}
+				if !ok {
+					partial = len(n.next) != 0
+					break
+				}
+			}
+			if n = next; n == nil {
+				break
+			}
+			if n.mask != nil {
+				mask, size = n.mask, j-i+1
+			}
+		}
+		if partial && !flush {
+			break
+		}
+		if mask != nil {
+			out.Write(mask)
+			i += size
+			continue
+		}
+		out.WriteByte(r.buf[i])
+		i++
+	}
+	r.buf = append(r.buf[:0], r.buf[i:]...)
+	return out.Bytes()
+}
+
+// escape returns the size of the terminal control sequence at
+// the start of b, or zero if b does not start with a control
+// sequence. If b ends before the sequence is complete, escape
+// returns zero and false.
+func escape(b []byte) (size int, ok bool) {
+	if len(b) < 2 {
+		return 0, len(b) == 0 || b[0] != 0x1b
+	}
+	if b[0] != 0x1b || b[1] != '[' {
+		return 0, true
+	}
+	// the control sequence is defined as parameter bytes,
+	// intermediate bytes and a final byte.
+	i := 2
+	for i < len(b) && b[i] >= 0x30 && b[i] <= 0x3f {
+		i++
+	}
+	for i < len(b) && b[i] >= 0x20 && b[i] <= 0x2f {
+		i++
+	}
+	if i == len(b) {
+		return 0, false
+	}
+	if b[i] < 0x40 || b[i] > 0x7e {
+		return 0, true
+	}
+	return i + 1, true
+}
+
+// insert adds the sensitive value to the trie. If the value
+// already exists the existing mask is kept.
+func (n *node) insert(value string, mask []byte) {
+	if value == "" {
+		return
+	}
+	for i := 0; i < len(value); i++ {
+		next, ok := n.next[value[i]]
+		if !ok {
+			next = &node{next: map[byte]*node{}}
+			n.next[value[i]] = next
+		}
+		n = next
+	}
+	if n.mask == nil {
+		n.mask = mask
+	}
+}
+
+// helper function returns the secret and the commonly encoded
+// forms of the secret. Each line of a multi-line secret is also
+// returned, since secrets are often printed line by line, unless
+// the line is short, or contains no letters or digits.
+func variants(secret string) []string {
+	values := []string{
+		secret,
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		base64.RawStdEncoding.EncodeToString([]byte(secret)),
+		base64.URLEncoding.EncodeToString([]byte(secret)),
+		base64.RawURLEncoding.EncodeToString([]byte(secret)),
+		url.QueryEscape(secret),
+		url.PathEscape(secret),
+		jsonEscape(secret, true),
+		jsonEscape(secret, false),
+	}
+	if strings.Contains(secret, "\n") {
+		for _, line := range strings.Split(secret, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) < minLineLength || strings.IndexFunc(line, isAlphanumeric) == -1 {
+				continue
+			}
+			values = append(values, line)
+		}
+	}
+	return values
+}
+
+// helper function returns the secret escaped as a json string,
+// without the enclosing quotes.
+func jsonEscape(secret string, html bool) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(html)
+	enc.Encode(secret)
+	s := strings.TrimSuffix(buf.String(), "\n")
+	return strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+}
+
+func isAlphanumeric(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
@@ -8,7 +8,11 @@ package replacer
 
 import (
 	"bytes"
+	"encoding/base64"
+	"fmt"
 	"io"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
@@ -47,6 +51,146 @@ func TestReplaceNone(t *testing.T) {
 	}
 }
 
+// this test verifies that a secret split across writes is
+// masked, and that the held back data is written on close.
+func TestReplaceSplit(t *testing.T) {
+	secrets := []*engine.Secret{
+		{Name: "PASSWORD", Data: []byte("correct-horse-batter-staple"), Mask: true},
+	}
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf}, secrets)
+	w.Write([]byte("password correct-hor"))
+	if got, want := buf.String(), "password "; got != want {
+		t.Errorf("Want partial secret held back, got %q", got)
+	}
+	w.Write([]byte("se-batter-staple\n"))
+	w.Write([]byte("done correct"))
+	w.Close()
+	if got, want := buf.String(), "password [secret:password]\ndone correct"; got != want {
+		t.Errorf("Want masked string %q, got %q", want, got)
+	}
+}
+
+// this test verifies that common encodings of a secret are
+// masked.
+func TestReplaceEncoded(t *testing.T) {
+	secret := `p@ss word/"quoted"?&<x>`
+	secrets := []*engine.Secret{
+		{Name: "PASSWORD", Data: []byte(secret), Mask: true},
+	}
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		base64.RawURLEncoding.EncodeToString([]byte(secret)),
+		url.QueryEscape(secret),
+		url.PathEscape(secret),
+		`p@ss word/\"quoted\"?&<x>`,
+		`p@ss word/\"quoted\"?\u0026\u003cx\u003e`,
+	} {
+		buf := new(bytes.Buffer)
+		w := New(&nopCloser{buf}, secrets)
+		w.Write([]byte("value=" + encoded + "\n"))
+		w.Close()
+		if got, want := buf.String(), "value=[secret:password]\n"; got != want {
+			t.Errorf("Want encoded secret %q masked, got %q", encoded, got)
+		}
+	}
+}
+
+// this test verifies that each line of a multi-line secret is
+// masked.
+func TestReplaceMultiline(t *testing.T) {
+	secrets := []*engine.Secret{
+		{Name: "SSH_KEY", Data: []byte("-----BEGIN KEY-----\n  MIIEpAIBAAKCAQEA\n-----END KEY-----\n"), Mask: true},
+	}
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf}, secrets)
+	w.Write([]byte("+ echo $SSH_KEY\n-----BEGIN KEY----- MIIEpAIBAAKCAQEA -----END KEY-----\n"))
+	w.Close()
+	want := "+ echo $SSH_KEY\n[secret:ssh_key] [secret:ssh_key] [secret:ssh_key]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want masked string %q, got %q", want, got)
+	}
+}
+
+// this test verifies that short lines, and lines without letters
+// or digits, of a multi-line secret are not masked on their own.
+func TestReplaceMultiline_Short(t *testing.T) {
+	secrets := []*engine.Secret{
+		{Name: "CREDENTIALS", Data: []byte("{\n  \"token\": \"correct-horse-battery-staple\",\n  \"id\": 1\n}\n"), Mask: true},
+	}
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf}, secrets)
+	w.Write([]byte("{\"id\": 1}\n\"token\": \"correct-horse-battery-staple\",\n"))
+	w.Close()
+	want := "{\"id\": 1}\n[secret:credentials]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want masked string %q, got %q", want, got)
+	}
+}
+
+// this test verifies that a secret is masked when terminal
+// color codes are inserted inside the secret, including color
+// codes split across writes.
+func TestReplaceEscape(t *testing.T) {
+	secrets := []*engine.Secret{
+		{Name: "PASSWORD", Data: []byte("correct-horse-batter-staple"), Mask: true},
+	}
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf}, secrets)
+	w.Write([]byte("\x1b[1mpassword\x1b[0m correct-\x1b[31mhorse\x1b[0m-batter-\x1b"))
+	w.Write([]byte("[38;5;196mstaple\x1b[0m\n"))
+	w.Write([]byte("correct-\x1b[1mhorse\n"))
+	w.Close()
+	want := "\x1b[1mpassword\x1b[0m [secret:password]\x1b[0m\ncorrect-\x1b[1mhorse\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want masked string %q, got %q", want, got)
+	}
+}
+
+// this fuzz test verifies that the masked output does not
+// depend on how the stream is split into writes, and that the
+// secret does not appear in the masked output.
+func FuzzReplace(f *testing.F) {
+	f.Add("correct-horse", "username octocat password correct-horse", uint8(7))
+	f.Add("a\nb", "a b a\nb", uint8(1))
+	f.Add("abab", "aababababa", uint8(3))
+	f.Fuzz(func(t *testing.T, secret, text string, size uint8) {
+		secrets := []*engine.Secret{
+			{Name: "TOKEN", Data: []byte(secret), Mask: true},
+		}
+		want := new(bytes.Buffer)
+		w := New(&nopCloser{want}, secrets)
+		w.Write([]byte(text))
+		w.Close()
+
+		got := new(bytes.Buffer)
+		w = New(&nopCloser{got}, secrets)
+		chunk := int(size%16) + 1
+		for i := 0; i < len(text); i += chunk {
+			end := i + chunk
+			if end > len(text) {
+				end = len(text)
+			}
+			w.Write([]byte(text[i:end]))
+		}
+		w.Close()
+
+		if got.String() != want.String() {
+			t.Errorf("Want output %q, got %q with writes of %d bytes", want, got, chunk)
+		}
+		// the secret may be formed by the mask itself, or by the
+		// mask and the surrounding text, so the masks are removed
+		// before the output is checked.
+		if secret == "" || strings.Contains(secret, "\x00") {
+			return
+		}
+		mask := fmt.Sprintf(maskedf, "token")
+		if strings.Contains(strings.ReplaceAll(got.String(), mask, "\x00"), secret) {
+			t.Errorf("Want secret %q masked, got %q", secret, got)
+		}
+	})
+}
+
 type nopCloser struct {
 	io.Writer
 }
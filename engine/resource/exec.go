@@ -4,7 +4,11 @@
 
 package resource
 
-import "github.com/drone/runner-go/manifest"
+import (
+	"time"
+
+	"github.com/drone/runner-go/manifest"
+)
 
 var (
 	_ manifest.Resource          = (*Pipeline)(nil)
@@ -23,15 +27,21 @@ type (
 	// Pipeline is a pipeline resource that executes pipelines
 	// on the host machine without any virtualization.
 	Pipeline struct {
-		Version   string              `json:"version,omitempty"`
-		Kind      string              `json:"kind,omitempty"`
-		Type      string              `json:"type,omitempty"`
-		Name      string              `json:"name,omitempty"`
-		Deps      []string            `json:"depends_on,omitempty"`
-		Clone     manifest.Clone      `json:"clone,omitempty"`
-		Platform  manifest.Platform   `json:"platform,omitempty"`
-		Trigger   manifest.Conditions `json:"conditions,omitempty"`
-		Workspace manifest.Workspace  `json:"workspace,omitempty"`
+		Version     string                        `json:"version,omitempty"`
+		Kind        string                        `json:"kind,omitempty"`
+		Type        string                        `json:"type,omitempty"`
+		Name        string                        `json:"name,omitempty"`
+		Deps        []string                      `json:"depends_on,omitempty"`
+		Clone       manifest.Clone                `json:"clone,omitempty"`
+		Platform    manifest.Platform             `json:"platform,omitempty"`
+		Trigger     manifest.Conditions           `json:"conditions,omitempty"`
+		Workspace   manifest.Workspace            `json:"workspace,omitempty"`
+		Environment map[string]*manifest.Variable `json:"environment,omitempty"`
+		Artifacts   []string                      `json:"artifacts,omitempty"`
+		Matrix      map[string][]string           `json:"matrix,omitempty"`
+		Cache       *Cache                        `json:"cache,omitempty"`
+		User        string                        `json:"user,omitempty"`
+		Limits      Limits                        `json:"limits,omitempty"`
 
 		Steps []*Step `json:"steps,omitempty"`
 	}
@@ -44,7 +54,12 @@ type (
 		Detach      bool                          `json:"detach,omitempty"`
 		Environment map[string]*manifest.Variable `json:"environment,omitempty"`
 		Failure     string                        `json:"failure,omitempty"`
+		Optional    bool                          `json:"optional,omitempty"`
 		Commands    []string                      `json:"commands,omitempty"`
+		Ready       *Ready                        `json:"ready,omitempty"`
+		Reports     *Reports                      `json:"reports,omitempty"`
+		Retry       *Retry                        `json:"retry,omitempty"`
+		Timeout     time.Duration                 `json:"timeout,omitempty"`
 		When        manifest.Conditions           `json:"when,omitempty"`
 
 		// Image is an unsupported field but is defined so
@@ -52,6 +67,52 @@ type (
 		// field and return a linting error.
 		Image string `json:"-"`
 	}
+
+	// Cache defines the workspace cache. Paths are relative
+	// to the workspace, or to the home directory if prefixed
+	// with a tilde. The cache key optionally includes a hash
+	// of the listed workspace files.
+	Cache struct {
+		Key   string   `json:"key,omitempty"`
+		Hash  []string `json:"hash,omitempty"`
+		Paths []string `json:"paths,omitempty"`
+	}
+
+	// Reports defines the structured test reports produced
+	// by a step. Paths are glob patterns relative to the
+	// workspace.
+	Reports struct {
+		JUnit string `json:"junit,omitempty"`
+	}
+
+	// Retry defines the retry policy of a step. A failed step
+	// is executed again, up to the maximum number of attempts,
+	// optionally only when it exits with one of the exit codes.
+	// The delay between attempts is multiplied by the backoff
+	// factor after each attempt.
+	Retry struct {
+		Attempts  int           `json:"attempts,omitempty"`
+		Delay     time.Duration `json:"delay,omitempty"`
+		Backoff   float64       `json:"backoff,omitempty"`
+		ExitCodes []int         `json:"exit_codes,omitempty" yaml:"exit_codes"`
+	}
+
+	// Limits defines the resource limits applied to each
+	// pipeline step.
+	Limits struct {
+		Memory manifest.BytesSize `json:"memory,omitempty"`
+		CPU    float64            `json:"cpu,omitempty"`
+		Pids   int64              `json:"pids,omitempty"`
+	}
+
+	// Ready defines the readiness conditions of a detached
+	// step. Steps that depend on the detached step are not
+	// started until all conditions are satisfied.
+	Ready struct {
+		TCP     string        `json:"tcp,omitempty"`
+		File    string        `json:"file,omitempty"`
+		Timeout time.Duration `json:"timeout,omitempty"`
+	}
 )
 
 // GetVersion returns the resource version.
@@ -0,0 +1,44 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Combine returns each combination of the matrix values, as a
+// list of name and value pairs sorted by name.
+func Combine(matrix map[string][]string) [][][2]string {
+	var keys []string
+	for key := range matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	axes := [][][2]string{{}}
+	for _, key := range keys {
+		var next [][][2]string
+		for _, axis := range axes {
+			for _, value := range matrix[key] {
+				pairs := append(append([][2]string{}, axis...), [2]string{key, value})
+				next = append(next, pairs)
+			}
+		}
+		axes = next
+	}
+	return axes
+}
+
+// MatrixName returns the name of the step expanded for the
+// matrix combination, for example `test (db=mysql, go=1.21)`.
+func MatrixName(name string, axis [][2]string) string {
+	var parts []string
+	for _, pair := range axis {
+		parts = append(parts, pair[0]+"="+pair[1])
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(parts, ", "))
+}
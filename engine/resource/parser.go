@@ -6,6 +6,8 @@ package resource
 
 import (
 	"errors"
+	"path/filepath"
+	"strings"
 
 	"github.com/drone/runner-go/manifest"
 
@@ -37,6 +39,18 @@ func match(r *manifest.RawResource) bool {
 
 // lint returns an error if any pipeline values are invalid.
 func lint(pipeline *Pipeline) error {
+	if err := lintCache(pipeline.Cache); err != nil {
+		return err
+	}
+	if err := lintArtifacts(pipeline.Artifacts); err != nil {
+		return err
+	}
+	if err := lintMatrix(pipeline.Matrix); err != nil {
+		return err
+	}
+	if err := lintEnvironment(pipeline.Environment); err != nil {
+		return err
+	}
 	names := map[string]struct{}{}
 	for _, step := range pipeline.Steps {
 		if step.Name == "" {
@@ -45,10 +59,177 @@ func lint(pipeline *Pipeline) error {
 		if _, ok := names[step.Name]; ok {
 			return errors.New("Linter: duplicate step name")
 		}
+		if step.Name == "artifacts" && len(pipeline.Artifacts) != 0 {
+			return errors.New("Linter: step name artifacts is reserved for the pipeline artifacts")
+		}
 		if step.Image != "" {
 			return errors.New("Linter: cannot define images for an exec pipeline")
 		}
+		if step.Ready != nil && step.Detach == false {
+			return errors.New("Linter: readiness conditions require a detached step")
+		}
+		if err := lintEnvironment(step.Environment); err != nil {
+			return err
+		}
+		if err := lintReports(step); err != nil {
+			return err
+		}
+		if err := lintRetry(step); err != nil {
+			return err
+		}
 		names[step.Name] = struct{}{}
 	}
+	return lintMatrixNames(pipeline)
+}
+
+// lintCache returns an error if any cache paths are invalid.
+func lintCache(cache *Cache) error {
+	if cache == nil {
+		return nil
+	}
+	for _, path := range append(cache.Paths, cache.Hash...) {
+		if path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+			return errors.New("Linter: cache paths must be relative")
+		}
+		if hasParent(path) {
+			return errors.New("Linter: cache paths cannot reference parent directories")
+		}
+	}
+	return nil
+}
+
+// lintArtifacts returns an error if any artifact patterns are
+// invalid.
+func lintArtifacts(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" || filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/") {
+			return errors.New("Linter: artifact paths must be relative")
+		}
+		if hasParent(pattern) {
+			return errors.New("Linter: artifact paths cannot reference parent directories")
+		}
+	}
+	return nil
+}
+
+// lintMatrix returns an error if the matrix is invalid.
+func lintMatrix(matrix map[string][]string) error {
+	for name, values := range matrix {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return errors.New("Linter: invalid matrix variable name")
+		}
+		if len(values) == 0 {
+			return errors.New("Linter: matrix variables require at least one value")
+		}
+		seen := map[string]struct{}{}
+		for _, value := range values {
+			if _, ok := seen[value]; ok {
+				return errors.New("Linter: duplicate matrix value")
+			}
+			seen[value] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// lintMatrixNames returns an error if the step names are not
+// unique once the steps are expanded for each combination of
+// the matrix values.
+func lintMatrixNames(pipeline *Pipeline) error {
+	if len(pipeline.Matrix) == 0 {
+		return nil
+	}
+	names := map[string]struct{}{}
+	for _, axis := range Combine(pipeline.Matrix) {
+		for _, step := range pipeline.Steps {
+			name := MatrixName(step.Name, axis)
+			if _, ok := names[name]; ok {
+				return errors.New("Linter: duplicate step name after matrix expansion")
+			}
+			names[name] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// lintEnvironment returns an error if the name of a variable
+// derived from a secret is invalid. The secret may be written
+// to a file named after the variable, so the name is limited
+// to letters, digits and underscores.
+func lintEnvironment(env map[string]*manifest.Variable) error {
+	for name, v := range env {
+		if v == nil || strings.TrimSpace(v.Secret) == "" {
+			continue
+		}
+		if !isEnvName(name) {
+			return errors.New("Linter: invalid secret environment variable name")
+		}
+	}
+	return nil
+}
+
+// lintReports returns an error if any test report patterns are
+// invalid.
+func lintReports(step *Step) error {
+	if step.Reports == nil {
+		return nil
+	}
+	if step.Detach {
+		return errors.New("Linter: cannot define reports for a detached step")
+	}
+	pattern := step.Reports.JUnit
+	if pattern == "" || filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/") {
+		return errors.New("Linter: report paths must be relative")
+	}
+	if hasParent(pattern) {
+		return errors.New("Linter: report paths cannot reference parent directories")
+	}
 	return nil
 }
+
+// lintRetry returns an error if the retry policy is invalid.
+func lintRetry(step *Step) error {
+	if step.Retry == nil {
+		return nil
+	}
+	if step.Detach {
+		return errors.New("Linter: cannot retry a detached step")
+	}
+	if step.Retry.Attempts < 1 {
+		return errors.New("Linter: retry attempts must be greater than zero")
+	}
+	if step.Retry.Delay < 0 || step.Retry.Backoff < 0 {
+		return errors.New("Linter: retry delay and backoff cannot be negative")
+	}
+	return nil
+}
+
+// helper function returns true if the name is a non-empty
+// string of letters, digits and underscores.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9':
+		case r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// helper function returns true if the path references the
+// parent directory.
+func hasParent(path string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
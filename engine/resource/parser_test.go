@@ -6,6 +6,7 @@ package resource
 
 import (
 	"testing"
+	"time"
 
 	"github.com/drone/runner-go/manifest"
 
@@ -45,6 +46,11 @@ func TestParse(t *testing.T) {
 			Clone: manifest.Clone{
 				Depth: 50,
 			},
+			Limits: Limits{
+				Memory: 1073741824,
+				CPU:    2,
+				Pids:   100,
+			},
 			Trigger: manifest.Conditions{
 				Branch: manifest.Condition{
 					Include: []string{"master"},
@@ -65,6 +71,11 @@ func TestParse(t *testing.T) {
 						"GOARCH": &manifest.Variable{Value: "arm64"},
 					},
 					Failure: "never",
+					Timeout: 10 * time.Minute,
+					Ready: &Ready{
+						TCP:     "localhost:5432",
+						Timeout: 30 * time.Second,
+					},
 					When: manifest.Conditions{
 						Event: manifest.Condition{
 							Include: []string{"push"},
@@ -148,6 +159,148 @@ func TestLint(t *testing.T) {
 		t.Errorf("Expect error when empty name")
 	}
 
+	p.Steps = []*Step{{Name: "build"}}
+	p.Cache = &Cache{Paths: []string{"node_modules", "~/go/pkg/mod"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when relative cache paths, got %s", err)
+	}
+
+	p.Cache = &Cache{Paths: []string{"/etc"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when absolute cache path")
+	}
+
+	p.Cache = &Cache{Paths: []string{"../../other"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when cache path references parent directory")
+	}
+
+	p.Cache = &Cache{Paths: []string{"vendor"}, Hash: []string{"/etc/passwd"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when absolute cache hash path")
+	}
+	p.Cache = nil
+
+	p.Steps = []*Step{{Name: "build"}}
+	p.Artifacts = []string{"dist/*.tar.gz", "coverage/**"}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when relative artifact paths, got %s", err)
+	}
+
+	p.Artifacts = []string{"/etc/shadow"}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when absolute artifact path")
+	}
+
+	p.Artifacts = []string{"../*"}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when artifact path references parent directory")
+	}
+
+	p.Artifacts = []string{"dist/*"}
+	p.Steps = []*Step{{Name: "artifacts"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when step name reserved for artifacts")
+	}
+	p.Artifacts = nil
+
+	p.Steps = []*Step{{Name: "test"}}
+	p.Matrix = map[string][]string{"GO_VERSION": {"1.20", "1.21"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when matrix defined, got %s", err)
+	}
+
+	p.Matrix = map[string][]string{"GO_VERSION": {}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when matrix values empty")
+	}
+
+	p.Matrix = map[string][]string{"": {"1.21"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when matrix variable name empty")
+	}
+
+	p.Matrix = map[string][]string{"GO_VERSION": {"1.20", "1.20"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when matrix values duplicated")
+	}
+
+	p.Matrix = map[string][]string{"A": {"1", "1, B=2"}, "B": {"2", "2, B=2"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when expanded step names duplicated")
+	}
+	p.Matrix = nil
+
+	p.Steps = []*Step{{Name: "test", Reports: &Reports{JUnit: "**/TEST-*.xml"}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when relative report paths, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "test", Reports: &Reports{JUnit: "/tmp/*.xml"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when absolute report path")
+	}
+
+	p.Steps = []*Step{{Name: "test", Reports: &Reports{JUnit: "../*.xml"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when report path references parent directory")
+	}
+
+	p.Steps = []*Step{{Name: "test", Detach: true, Reports: &Reports{JUnit: "*.xml"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when reports defined for a detached step")
+	}
+
+	p.Steps = []*Step{{Name: "test", Retry: &Retry{Attempts: 3, Delay: time.Second, Backoff: 2}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when retry policy defined, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "test", Retry: &Retry{}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when retry attempts missing")
+	}
+
+	p.Steps = []*Step{{Name: "test", Retry: &Retry{Attempts: 2, Delay: -time.Second}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when retry delay negative")
+	}
+
+	p.Steps = []*Step{{Name: "redis", Detach: true, Retry: &Retry{Attempts: 2}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when retry policy defined for a detached step")
+	}
+
+	p.Steps = []*Step{{Name: "redis", Ready: &Ready{TCP: "localhost:6379"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when readiness conditions without detach")
+	}
+
+	p.Steps = []*Step{{Name: "redis", Detach: true, Ready: &Ready{TCP: "localhost:6379"}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when detached, got %s", err)
+	}
+
+	secret := &manifest.Variable{Secret: "password"}
+	p.Steps = []*Step{{Name: "test", Environment: map[string]*manifest.Variable{"DOCKER_PASSWORD": secret}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error when secret variable name valid, got %s", err)
+	}
+
+	for _, name := range []string{"", "../../etc/cron.d/pwn", "a/b", "..", "DOCKER-PASSWORD"} {
+		p.Steps = []*Step{{Name: "test", Environment: map[string]*manifest.Variable{name: secret}}}
+		if err := lint(p); err == nil {
+			t.Errorf("Expect error when secret variable name %q", name)
+		}
+	}
+
+	p.Steps = []*Step{{Name: "test"}}
+	p.Environment = map[string]*manifest.Variable{"../PASSWORD": secret}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when pipeline secret variable name invalid")
+	}
+	p.Environment = nil
+
 	p.Steps = []*Step{{Name: "build"}, {Name: "test", Image: "plugins/docker"}}
 	if err := lint(p); err == nil {
 		t.Errorf("Expect error when image defined")
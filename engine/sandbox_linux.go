@@ -0,0 +1,372 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxInit is the program name used to identify the sandbox
+// init process. The engine re-executes the current program with
+// this name to configure the sandbox before the step command is
+// executed.
+const sandboxInit = "drone-sandbox-init"
+
+// sandboxHostname is the hostname of the sandbox.
+const sandboxHostname = "drone"
+
+// sandboxMasks is the list of host directories that are hidden
+// from the sandbox, in addition to the parent directory of the
+// pipeline root, which contains other pipeline workspaces.
+var sandboxMasks = []string{
+	"/root",
+	"/home",
+}
+
+// sandboxConfig configures the sandbox init process.
+type sandboxConfig struct {
+	Root   string   `json:"root"`
+	Dir    string   `json:"dir"`
+	User   bool     `json:"user,omitempty"`
+	Uid    uint32   `json:"uid,omitempty"`
+	Gid    uint32   `json:"gid,omitempty"`
+	Groups []uint32 `json:"groups,omitempty"`
+}
+
+// InitSandbox executes the sandbox init process if the program
+// was started by the engine as the sandbox init process, in
+// which case the function does not return. The function must be
+// invoked at the start of the program.
+func InitSandbox() {
+	if len(os.Args) < 3 || os.Args[0] != sandboxInit {
+		return
+	}
+	conf := new(sandboxConfig)
+	err := json.Unmarshal([]byte(os.Args[1]), conf)
+	if err == nil {
+		var code int
+		code, err = initSandbox(conf, os.Args[2:])
+		if err == nil {
+			os.Exit(code)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "sandbox: %s\n", err)
+	os.Exit(255)
+}
+
+// sandboxSignals is the list of signals the sandbox init
+// process forwards to the sandbox processes.
+var sandboxSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// helper function configures the command to execute in the
+// sandbox. The command is executed by the sandbox init process
+// in new user, mount, pid, ipc and uts namespaces. The user
+// namespace maps all host users to themselves, so that file
+// ownership is unchanged, but the sandbox processes have no
+// capabilities outside of the sandbox.
+func sandbox(cmd *exec.Cmd, spec *Spec) error {
+	conf := &sandboxConfig{
+		Root: spec.Root,
+		Dir:  cmd.Dir,
+	}
+	// the init process requires elevated privileges to
+	// configure the sandbox, and drops privileges to the
+	// pipeline user before executing the command.
+	if spec.User != "" {
+		cred, err := lookupCredential(spec.User, spec.Group)
+		if err != nil {
+			return err
+		}
+		conf.User = true
+		conf.Uid = cred.Uid
+		conf.Gid = cred.Gid
+		conf.Groups = cred.Groups
+	}
+	raw, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{sandboxInit, string(raw), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/proc/self/exe"
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER |
+		syscall.CLONE_NEWNS |
+		syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC |
+		syscall.CLONE_NEWUTS
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: 0, Size: 1<<32 - 1},
+	}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: 0, Size: 1<<32 - 1},
+	}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = true
+	return nil
+}
+
+// helper function configures the sandbox, executes the command
+// and returns its exit code. The host filesystem is mounted
+// read-only, with the exception of the pipeline root.
+func initSandbox(conf *sandboxConfig, args []string) (int, error) {
+	// the capabilities are dropped for the current thread, and
+	// are inherited by the command, which must therefore be
+	// started from the same thread.
+	runtime.LockOSThread()
+
+	// prevent mount changes from propagating to the host.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return 0, fmt.Errorf("cannot make mounts private: %s", err)
+	}
+
+	// the pipeline root is opened before the host directories
+	// are masked, so that it can be mounted in the sandbox.
+	root, err := os.Open(conf.Root)
+	if err != nil {
+		return 0, err
+	}
+	defer root.Close()
+
+	mounts, err := readMounts()
+	if err != nil {
+		return 0, err
+	}
+	for _, mount := range mounts {
+		if mount.path == "/proc" || strings.HasPrefix(mount.path, "/proc/") {
+			continue
+		}
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		if err := syscall.Mount("", mount.path, "", flags|mount.flags, ""); err != nil {
+			return 0, fmt.Errorf("cannot remount %s read-only: %s", mount.path, err)
+		}
+	}
+
+	// mask sensitive host directories and the workspaces of
+	// other pipelines with empty, temporary filesystems.
+	var masked []string
+	for _, dir := range append(sandboxMasks, filepath.Dir(conf.Root)) {
+		if dir == "/" {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=755"); err != nil {
+			return 0, fmt.Errorf("cannot mask %s: %s", dir, err)
+		}
+		masked = append(masked, dir)
+	}
+
+	// mount the pipeline root, which is the only writable
+	// host directory in the sandbox.
+	if err := os.MkdirAll(conf.Root, 0755); err != nil {
+		return 0, err
+	}
+	source := fmt.Sprintf("/proc/self/fd/%d", root.Fd())
+	if err := syscall.Mount(source, conf.Root, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return 0, fmt.Errorf("cannot mount %s: %s", conf.Root, err)
+	}
+	if err := syscall.Mount("", conf.Root, "", syscall.MS_BIND|syscall.MS_REMOUNT, ""); err != nil {
+		return 0, fmt.Errorf("cannot remount %s read-write: %s", conf.Root, err)
+	}
+
+	for _, dir := range masked {
+		flags := uintptr(syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV)
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", flags, "mode=755"); err != nil {
+			return 0, fmt.Errorf("cannot remount %s read-only: %s", dir, err)
+		}
+	}
+
+	// mount the proc filesystem for the new pid namespace.
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	if err := syscall.Mount("proc", "/proc", "proc", flags, ""); err != nil {
+		return 0, fmt.Errorf("cannot mount proc: %s", err)
+	}
+
+	if err := syscall.Sethostname([]byte(sandboxHostname)); err != nil {
+		return 0, fmt.Errorf("cannot set hostname: %s", err)
+	}
+
+	// the sandbox processes cannot change the mounts once the
+	// capability is dropped. The mounts are locked in any user
+	// namespace created by the sandbox processes.
+	if err := dropCapability(unix.CAP_SYS_ADMIN); err != nil {
+		return 0, fmt.Errorf("cannot drop capabilities: %s", err)
+	}
+
+	if err := os.Chdir(conf.Dir); err != nil {
+		return 0, err
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return 0, err
+	}
+	attr := &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys:   new(syscall.SysProcAttr),
+	}
+	if conf.User {
+		attr.Sys.Credential = &syscall.Credential{
+			Uid:    conf.Uid,
+			Gid:    conf.Gid,
+			Groups: conf.Groups,
+		}
+	}
+
+	// signals are forwarded to the sandbox processes, since the
+	// kernel does not deliver signals to the sandbox init
+	// process unless it handles the signal.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sandboxSignals...)
+	proc, err := os.StartProcess(path, args, attr)
+	if err != nil {
+		return 0, err
+	}
+	go func() {
+		for sig := range signals {
+			syscall.Kill(-1, sig.(syscall.Signal))
+		}
+	}()
+	return reap(proc.Pid), nil
+}
+
+// helper function waits for the process to exit and returns its
+// exit code. The orphaned processes that are re-parented to the
+// sandbox init process are reaped while waiting.
+func reap(pid int) int {
+	for {
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 255
+		}
+		if wpid != pid {
+			continue
+		}
+		if status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return status.ExitStatus()
+	}
+}
+
+// helper function drops the capability from the bounding set
+// and from the capability sets of the current thread, so that
+// the capability cannot be regained by executing a program.
+func dropCapability(c uintptr) error {
+	if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+		return err
+	}
+	hdr := &unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(hdr, &data[0]); err != nil {
+		return err
+	}
+	mask := ^uint32(1 << (c % 32))
+	data[c/32].Effective &= mask
+	data[c/32].Permitted &= mask
+	data[c/32].Inheritable &= mask
+	return unix.Capset(hdr, &data[0])
+}
+
+// mount represents a mount point and its per-mount flags.
+type mount struct {
+	path  string
+	flags uintptr
+}
+
+// helper function returns the mount points of the current
+// mount namespace.
+func readMounts() ([]*mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []*mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		mounts = append(mounts, &mount{
+			path:  unescapeMount(fields[4]),
+			flags: mountFlags(fields[5]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// helper function returns the per-mount flags that must be
+// preserved when the mount is remounted.
+func mountFlags(options string) uintptr {
+	var flags uintptr
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "nosuid":
+			flags |= syscall.MS_NOSUID
+		case "nodev":
+			flags |= syscall.MS_NODEV
+		case "noexec":
+			flags |= syscall.MS_NOEXEC
+		case "noatime":
+			flags |= syscall.MS_NOATIME
+		case "nodiratime":
+			flags |= syscall.MS_NODIRATIME
+		case "relatime":
+			flags |= syscall.MS_RELATIME
+		case "strictatime":
+			flags |= syscall.MS_STRICTATIME
+		}
+	}
+	return flags
+}
+
+// helper function unescapes the octal escape sequences in the
+// mount point path.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
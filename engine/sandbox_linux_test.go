@@ -0,0 +1,166 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the test binary is re-executed as the sandbox init process.
+func TestMain(m *testing.M) {
+	InitSandbox()
+	os.Exit(m.Run())
+}
+
+// This test verifies that the sandbox step can only write to the
+// pipeline root, and cannot read the workspace of other
+// pipelines. It requires the tests to execute as root.
+func TestRun_Sandbox(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	parent, err := ioutil.TempDir("", "drone-sandbox-")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(parent)
+
+	sibling := filepath.Join(parent, "drone-sibling")
+	os.MkdirAll(sibling, 0700)
+	ioutil.WriteFile(filepath.Join(sibling, "secret"), []byte("correct-horse-battery-staple"), 0600)
+
+	// the sandbox must not be able to unmount the masks, or
+	// remount the host filesystem read-write.
+	os.MkdirAll("/root", 0700)
+	ioutil.WriteFile("/root/.drone-sandbox-test", []byte("masked-host-file"), 0600)
+	defer os.Remove("/root/.drone-sandbox-test")
+
+	spec := &Spec{
+		Root:    filepath.Join(parent, "drone-random"),
+		Sandbox: true,
+	}
+	engine := New(Opts{})
+	if err := engine.Setup(nocontext, spec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	script := []string{
+		"echo $$",
+		"hostname",
+		"touch " + filepath.Join(spec.Root, "writable"),
+		"touch /sandbox-test-not-writable && echo host writable",
+		"cat " + filepath.Join(sibling, "secret") + " || true",
+		"umount /root 2>/dev/null; cat /root/.drone-sandbox-test 2>/dev/null || true",
+		"mount -o remount,rw / 2>/dev/null && touch /sandbox-test-remount && echo host remounted",
+		"true",
+	}
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", strings.Join(script, "\n")},
+		WorkingDir: spec.Root,
+	}
+	state, err := engine.Run(nocontext, spec, step, buf)
+	if err != nil {
+		t.Skipf("cannot create sandbox: %s", err)
+	}
+	out := buf.String()
+	if state.ExitCode != 0 {
+		if strings.Contains(out, "sandbox:") {
+			t.Skipf("cannot create sandbox: %s", out)
+		}
+		t.Errorf("Want exit code 0, got %d: %s", state.ExitCode, out)
+	}
+
+	lines := strings.Split(out, "\n")
+	if got := lines[0]; got == "1" || got == "" {
+		t.Errorf("Want step executed as a child of the sandbox init, got pid %q", got)
+	}
+	if got, want := lines[1], sandboxHostname; got != want {
+		t.Errorf("Want hostname %s, got %s", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(spec.Root, "writable")); err != nil {
+		t.Errorf("Want pipeline root writable")
+	}
+	if _, err := os.Stat("/sandbox-test-not-writable"); err == nil {
+		os.Remove("/sandbox-test-not-writable")
+		t.Errorf("Want host filesystem read-only")
+	}
+	if strings.Contains(out, "host writable") {
+		t.Errorf("Want host filesystem read-only")
+	}
+	if strings.Contains(out, "correct-horse-battery-staple") {
+		t.Errorf("Want workspace of other pipelines hidden")
+	}
+	if strings.Contains(out, "masked-host-file") {
+		t.Errorf("Want masked host directories cannot be unmounted")
+	}
+	if _, err := os.Stat("/sandbox-test-remount"); err == nil || strings.Contains(out, "host remounted") {
+		os.Remove("/sandbox-test-remount")
+		t.Errorf("Want host filesystem cannot be remounted read-write")
+	}
+}
+
+// This test verifies that the sandbox init process forwards the
+// terminate signal, so that a cancelled step exits without
+// waiting for the grace period. It requires the tests to
+// execute as root.
+func TestRun_SandboxCancel(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	spec := &Spec{
+		Root:    filepath.Join(t.TempDir(), "drone-random"),
+		Sandbox: true,
+	}
+	engine := New(Opts{GracePeriod: 10 * time.Second})
+	if err := engine.Setup(nocontext, spec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "trap 'exit 0' TERM; sleep 30 & wait"},
+		WorkingDir: spec.Root,
+	}
+	ctx, cancel := context.WithTimeout(nocontext, time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := engine.Run(ctx, spec, step, ioutil.Discard); err != context.DeadlineExceeded {
+		t.Skipf("cannot create sandbox: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Want cancelled step terminated before the grace period, took %s", elapsed)
+	}
+}
+
+func TestMountFlags(t *testing.T) {
+	got := mountFlags("rw,nosuid,nodev,noexec,relatime")
+	want := uintptr(0x2 | 0x4 | 0x8 | 1<<21)
+	if got != want {
+		t.Errorf("Want mount flags %x, got %x", want, got)
+	}
+}
+
+func TestUnescapeMount(t *testing.T) {
+	if got, want := unescapeMount(`/mnt/my\040disk`), "/mnt/my disk"; got != want {
+		t.Errorf("Want unescaped path %q, got %q", want, got)
+	}
+	if got, want := unescapeMount("/mnt/disk"), "/mnt/disk"; got != want {
+		t.Errorf("Want path %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package engine
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// InitSandbox is a no-op on systems that do not support the
+// sandbox.
+func InitSandbox() {}
+
+// helper function returns an error because the sandbox is only
+// supported on linux.
+func sandbox(cmd *exec.Cmd, spec *Spec) error {
+	return errors.New("sandbox: sandbox is only supported on linux")
+}
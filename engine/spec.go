@@ -4,22 +4,30 @@
 
 package engine
 
+import "time"
+
 type (
 	// Spec provides the pipeline spec. This provides the
 	// required instructions for reproducable pipeline
 	// execution.
 	Spec struct {
 		// Metadata Metadata  `json:"metadata,omitempty"`
+		Cache    *Cache   `json:"cache,omitempty"`
 		Platform Platform `json:"platform,omitempty"`
 		Root     string   `json:"root,omitempty"`
+		Sandbox  bool     `json:"sandbox,omitempty"`
 		Files    []*File  `json:"files,omitempty"`
+		Limits   *Limits  `json:"limits,omitempty"`
 		Links    []*Link  `json:"links,omitempty"`
 		Steps    []*Step  `json:"steps,omitempty"`
+		User     string   `json:"user,omitempty"`
+		Group    string   `json:"group,omitempty"`
 	}
 
 	// Step defines a pipeline step.
 	Step struct {
 		Args         []string          `json:"args,omitempty"`
+		Artifacts    *Artifacts        `json:"artifacts,omitempty"`
 		Command      string            `json:"command,omitempty"`
 		Detach       bool              `json:"detach,omitempty"`
 		DependsOn    []string          `json:"depends_on,omitempty"`
@@ -29,19 +37,80 @@ type (
 		IgnoreStdout bool              `json:"ignore_stderr,omitempty"`
 		IgnoreStderr bool              `json:"ignore_stdout,omitempty"`
 		Name         string            `json:"name,omitempt"`
+		Ready        *Ready            `json:"ready,omitempty"`
+		Reports      *Reports          `json:"reports,omitempty"`
+		Retry        *Retry            `json:"retry,omitempty"`
 		RunPolicy    RunPolicy         `json:"run_policy,omitempty"`
 		Secrets      []*Secret         `json:"secrets,omitempty"`
+		Timeout      time.Duration     `json:"timeout,omitempty"`
 		WorkingDir   string            `json:"working_dir,omitempty"`
 	}
 
+	// Artifacts defines the build outputs collected from the
+	// workspace and uploaded to the artifact store. A step that
+	// defines artifacts uploads the artifacts instead of
+	// executing a command.
+	Artifacts struct {
+		Dir    string   `json:"dir,omitempty"`
+		Paths  []string `json:"paths,omitempty"`
+		Prefix string   `json:"prefix,omitempty"`
+	}
+
+	// Reports defines the structured test reports parsed
+	// after the step executes. The summary of the test results
+	// is written to the step logs and to the summary file.
+	Reports struct {
+		Dir   string `json:"dir,omitempty"`
+		JUnit string `json:"junit,omitempty"`
+		Path  string `json:"path,omitempty"`
+	}
+
+	// Retry defines the retry policy of a step.
+	Retry struct {
+		Attempts  int           `json:"attempts,omitempty"`
+		Delay     time.Duration `json:"delay,omitempty"`
+		Backoff   float64       `json:"backoff,omitempty"`
+		ExitCodes []int         `json:"exit_codes,omitempty"`
+	}
+
+	// Cache defines the workspace cache. The cached paths are
+	// restored before the pipeline steps execute, and saved
+	// when the pipeline completes successfully. The cached
+	// paths must be within one of the root directories.
+	Cache struct {
+		Dir   string       `json:"dir,omitempty"`
+		Key   string       `json:"key,omitempty"`
+		Hash  []string     `json:"hash,omitempty"`
+		Paths []*CachePath `json:"paths,omitempty"`
+		Roots []string     `json:"roots,omitempty"`
+	}
+
+	// CachePath defines a cached path. The name uniquely
+	// identifies the path in the cache.
+	CachePath struct {
+		Name string `json:"name,omitempty"`
+		Path string `json:"path,omitempty"`
+	}
+
 	// File defines a file that should be uploaded or
 	// mounted somewhere in the step container or virtual
-	// machine prior to command execution.
+	// machine prior to command execution. A protected
+	// directory remains owned by the runner process, so that
+	// the pipeline steps cannot replace its contents.
 	File struct {
-		Path  string `json:"path,omitempty"`
-		Mode  uint32 `json:"mode,omitempty"`
-		Data  []byte `json:"data,omitempty"`
-		IsDir bool   `json:"is_dir,omitempty"`
+		Path      string `json:"path,omitempty"`
+		Mode      uint32 `json:"mode,omitempty"`
+		Data      []byte `json:"data,omitempty"`
+		IsDir     bool   `json:"is_dir,omitempty"`
+		Protected bool   `json:"protected,omitempty"`
+	}
+
+	// Limits defines the resource limits applied to each
+	// pipeline step. A zero value indicates no limit.
+	Limits struct {
+		Memory int64   `json:"memory,omitempty"`
+		CPU    float64 `json:"cpu,omitempty"`
+		Pids   int64   `json:"pids,omitempty"`
 	}
 
 	// Link defines a symbolic link.
@@ -58,12 +127,24 @@ type (
 		Version string `json:"version,omitempty"`
 	}
 
-	// Secret represents a secret variable.
+	// Ready defines the conditions that must be satisfied
+	// before a detached step is considered running, and its
+	// dependents are started.
+	Ready struct {
+		TCP     string        `json:"tcp,omitempty"`
+		File    string        `json:"file,omitempty"`
+		Timeout time.Duration `json:"timeout,omitempty"`
+	}
+
+	// Secret represents a secret variable. If the file is
+	// defined, the secret is written to the file and is not
+	// exported to the step environment.
 	Secret struct {
 		Name string `json:"name,omitempty"`
 		Env  string `json:"env,omitempty"`
 		Data []byte `json:"data,omitempty"`
 		Mask bool   `json:"mask,omitempty"`
+		File string `json:"file,omitempty"`
 	}
 
 	// State represents the process state.
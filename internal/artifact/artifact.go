@@ -0,0 +1,195 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package artifact collects build outputs from the workspace and
+// uploads them to an artifact store.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/docker/go-units"
+)
+
+// Store stores build artifacts.
+type Store interface {
+	// Put uploads the artifact to the named key.
+	Put(ctx context.Context, key string, file *File) error
+
+	// String returns the store location.
+	String() string
+}
+
+// File describes an artifact file.
+type File struct {
+	// Path is the file path, relative to the workspace.
+	Path string
+
+	// Source is the absolute path of the file on the host.
+	Source string
+
+	// Root is the absolute path of the directory the file was
+	// collected from. The file must be located in the root
+	// directory when it is opened.
+	Root string
+
+	// Size is the file size in bytes.
+	Size int64
+
+	// Checksum is the hex-encoded sha256 checksum of the file.
+	Checksum string
+}
+
+// Open opens the artifact file for reading. Symbolic links are
+// not followed, and the opened file must be a regular file
+// located in the root directory, since the workspace may have
+// changed since the file was collected.
+func (f *File) Open() (*os.File, error) {
+	file, err := openNoFollow(f.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.verify(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// helper function returns an error if the opened file is not a
+// regular file, or is not the file located at the source path
+// in the root directory.
+func (f *File) verify(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", f.Path)
+	}
+	root, err := filepath.EvalSymlinks(f.Root)
+	if err != nil {
+		return err
+	}
+	source, err := filepath.EvalSymlinks(f.Source)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, source)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside the workspace", f.Path)
+	}
+	stat, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, stat) {
+		return fmt.Errorf("%s changed while it was opened", f.Path)
+	}
+	return nil
+}
+
+// Collect returns the files in the directory that match the
+// artifact patterns. A pattern that matches a directory matches
+// all files in the directory. Symbolic links are not followed,
+// and are ignored.
+func Collect(dir string, patterns []string) ([]*File, error) {
+	var files []*File
+	err := filepath.Walk(dir, func(source string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, source)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !info.Mode().IsRegular() || !match(patterns, rel) {
+			return nil
+		}
+		files = append(files, &File{
+			Path:   rel,
+			Source: source,
+			Root:   dir,
+			Size:   info.Size(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// Upload collects the artifacts from the workspace and uploads
+// the artifacts to the store. The manifest of uploaded files is
+// written to the writer.
+func Upload(ctx context.Context, store Store, src *engine.Artifacts, w io.Writer) error {
+	files, err := Collect(src.Dir, src.Paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(w, "no artifacts found")
+		return nil
+	}
+
+	fmt.Fprintf(w, "uploading %d artifacts to %s\n", len(files), store)
+	var total int64
+	for _, file := range files {
+		if err := checksum(file); err != nil {
+			return err
+		}
+		if err := store.Put(ctx, path.Join(src.Prefix, file.Path), file); err != nil {
+			return fmt.Errorf("cannot upload %s: %s", file.Path, err)
+		}
+		total += file.Size
+		fmt.Fprintf(w, "%s\t%s\tsha256:%s\n",
+			file.Path,
+			units.HumanSize(float64(file.Size)),
+			file.Checksum,
+		)
+	}
+	fmt.Fprintf(w, "uploaded %d artifacts (%s)\n", len(files), units.HumanSize(float64(total)))
+	return nil
+}
+
+// helper function returns true if the path, or a parent
+// directory of the path, matches a pattern.
+func match(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+		for dir := name; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if ok, _ := doublestar.Match(pattern, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helper function computes the file size and checksum.
+func checksum(file *File) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	file.Size = n
+	file.Checksum = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"dist/app.tar.gz",
+		"dist/app.zip",
+		"coverage/unit/index.html",
+		"coverage/unit/style.css",
+		"main.go",
+	} {
+		writeFile(t, filepath.Join(dir, name), name)
+	}
+	// symbolic links are ignored to prevent the pipeline from
+	// uploading files outside of the workspace.
+	os.Symlink("/etc/passwd", filepath.Join(dir, "dist", "passwd.tar.gz"))
+
+	files, err := Collect(dir, []string{"dist/*.tar.gz", "coverage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Path)
+	}
+	want := []string{
+		"coverage/unit/index.html",
+		"coverage/unit/style.css",
+		"dist/app.tar.gz",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestCollect_Recursive(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a", "report.xml"), "")
+	writeFile(t, filepath.Join(dir, "a", "b", "c", "report.xml"), "")
+	writeFile(t, filepath.Join(dir, "a", "b", "c", "report.json"), "")
+
+	files, err := Collect(dir, []string{"**/*.xml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Want 2 files matched, got %d", len(files))
+	}
+}
+
+// This test verifies that a collected file cannot be replaced
+// by a symbolic link, or moved outside of the workspace, before
+// it is opened.
+func TestOpen_Replaced(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(dir, "dist", "app.txt"), "hello world")
+	writeFile(t, filepath.Join(outside, "app.txt"), "secret")
+
+	files, err := Collect(dir, []string{"dist/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Want 1 file matched, got %d", len(files))
+	}
+	file := files[0]
+
+	// the file is replaced by a symbolic link.
+	os.Remove(file.Source)
+	os.Symlink(filepath.Join(outside, "app.txt"), file.Source)
+	if f, err := file.Open(); err == nil {
+		f.Close()
+		t.Errorf("Want error opening a symbolic link")
+	}
+
+	// the parent directory is replaced by a symbolic link.
+	os.RemoveAll(filepath.Join(dir, "dist"))
+	os.Symlink(outside, filepath.Join(dir, "dist"))
+	if f, err := file.Open(); err == nil {
+		f.Close()
+		t.Errorf("Want error opening a file outside the workspace")
+	}
+}
+
+func TestUpload(t *testing.T) {
+	workspace := t.TempDir()
+	dest := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "dist", "app.txt"), "hello world")
+
+	buf := new(bytes.Buffer)
+	src := &engine.Artifacts{
+		Dir:    workspace,
+		Paths:  []string{"dist/*"},
+		Prefix: "octocat/hello-world/1/1",
+	}
+	if err := Upload(context.Background(), Local(dest), src, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(dest, "octocat", "hello-world", "1", "1", "dist", "app.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(raw), "hello world"; got != want {
+		t.Errorf("Want uploaded file %q, got %q", want, got)
+	}
+
+	// the manifest includes the path, size and checksum of
+	// each uploaded file.
+	manifest := buf.String()
+	if !strings.Contains(manifest, "dist/app.txt\t11B\tsha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9") {
+		t.Errorf("Want file listed in manifest, got\n%s", manifest)
+	}
+}
+
+func TestUpload_NoMatch(t *testing.T) {
+	buf := new(bytes.Buffer)
+	src := &engine.Artifacts{Dir: t.TempDir(), Paths: []string{"dist/*"}}
+	if err := Upload(context.Background(), Local(t.TempDir()), src, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "no artifacts found\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local returns a store that copies artifacts to a directory on
+// the host machine.
+func Local(dir string) Store {
+	return &local{dir: dir}
+}
+
+type local struct {
+	dir string
+}
+
+func (s *local) Put(ctx context.Context, key string, file *File) error {
+	dst := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// the file is written to a temporary file and renamed so
+	// that a partial upload is never visible.
+	out, err := os.Create(dst + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+func (s *local) String() string {
+	return s.dir
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible store.
+type S3Config struct {
+	// Endpoint is the S3 endpoint url. If empty, the Amazon S3
+	// endpoint for the region is used.
+	Endpoint string
+
+	// Bucket is the bucket name.
+	Bucket string
+
+	// Region is the bucket region.
+	Region string
+
+	// AccessKey and SecretKey are the credentials used to sign
+	// requests.
+	AccessKey string
+	SecretKey string
+
+	// PathStyle configures path-style requests, where the bucket
+	// is part of the request path instead of the hostname. Most
+	// self-hosted S3-compatible servers require path-style
+	// requests.
+	PathStyle bool
+}
+
+// S3 returns a store that uploads artifacts to an S3-compatible
+// bucket.
+func S3(config S3Config) (Store, error) {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	lookup := minio.BucketLookupDNS
+	if config.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure:       endpoint.Scheme != "http",
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3{config: config, client: client}, nil
+}
+
+type s3 struct {
+	config S3Config
+	client *minio.Client
+}
+
+func (s *s3) Put(ctx context.Context, key string, file *File) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = s.client.PutObject(ctx, s.config.Bucket, key, f, file.Size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *s3) String() string {
+	return fmt.Sprintf("s3://%s", s.config.Bucket)
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestS3_Put(t *testing.T) {
+	var path, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		path = r.URL.EscapedPath()
+		auth = r.Header.Get("Authorization")
+		body = string(raw)
+	}))
+	defer server.Close()
+
+	file := writeArtifact(t, "hello world")
+	store, err := S3(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "artifacts",
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "octocat/hello-world/1/1/dist/app (1).txt", file); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := path, "/artifacts/octocat/hello-world/1/1/dist/app%20%281%29.txt"; got != want {
+		t.Errorf("Want path %s, got %s", want, got)
+	}
+	// the body is uploaded with a signed chunked encoding.
+	if !strings.Contains(body, "hello world") {
+		t.Errorf("Want file uploaded, got body %q", body)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minioadmin/") {
+		t.Errorf("Want signed request, got authorization %q", auth)
+	}
+}
+
+func TestS3_PutError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(403)
+		w.Write([]byte("<Error><Code>SignatureDoesNotMatch</Code></Error>"))
+	}))
+	defer server.Close()
+
+	store, err := S3(S3Config{Endpoint: server.URL, Bucket: "artifacts", PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(context.Background(), "app.txt", writeArtifact(t, "hello world"))
+	if err == nil || minio.ToErrorResponse(err).Code != "SignatureDoesNotMatch" {
+		t.Errorf("Want error from server response, got %v", err)
+	}
+}
+
+func writeArtifact(t *testing.T, data string) *File {
+	path := filepath.Join(t.TempDir(), "app.txt")
+	ioutil.WriteFile(path, []byte(data), 0644)
+	file := &File{Path: "app.txt", Source: path, Root: filepath.Dir(path)}
+	if err := checksum(file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
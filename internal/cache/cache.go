@@ -0,0 +1,176 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package cache implements the workspace cache.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/filelock"
+
+	"github.com/gosimple/slug"
+)
+
+// Restore restores the cached paths from the cache directory.
+// Paths that do not exist in the cache are ignored.
+func Restore(spec *engine.Spec) error {
+	cache := spec.Cache
+	unlock, err := filelock.Lock(filepath.Join(cache.Dir, ".lock"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(cache.Dir, Key(cache))
+	for _, path := range cache.Paths {
+		src := filepath.Join(dir, name(path))
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			continue
+		}
+		dst, err := resolve(cache, path.Path)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		if err := copyAll(src, dst); err != nil {
+			return err
+		}
+		// the restored files are owned by the pipeline user
+		// so that the pipeline steps can modify them.
+		if err := engine.Chown(spec, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save saves the cached paths to the cache directory. The cache
+// entry is replaced when all paths are copied successfully.
+func Save(spec *engine.Spec) error {
+	cache := spec.Cache
+	if err := os.MkdirAll(cache.Dir, 0700); err != nil {
+		return err
+	}
+	unlock, err := filelock.Lock(filepath.Join(cache.Dir, ".lock"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the paths are copied to a temporary directory that is
+	// renamed once complete, to prevent a partially saved
+	// cache from being restored.
+	tmp, err := ioutil.TempDir(cache.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, path := range cache.Paths {
+		src, err := resolve(cache, path.Path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyAll(src, filepath.Join(tmp, name(path))); err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Join(cache.Dir, Key(cache))
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// Key returns the cache key. If the cache defines hash files, a
+// checksum of the file contents is appended to the key. Missing
+// hash files, and hash files outside of the root directories,
+// are ignored.
+func Key(cache *engine.Cache) string {
+	key := slug.Make(cache.Key)
+	if key == "" {
+		key = "default"
+	}
+	if len(cache.Hash) == 0 {
+		return key
+	}
+	h := sha256.New()
+	for _, path := range cache.Hash {
+		var raw []byte
+		if resolved, err := resolve(cache, path); err == nil {
+			raw, _ = ioutil.ReadFile(resolved)
+		}
+		h.Write([]byte(path))
+		h.Write(raw)
+	}
+	return key + "-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// helper function returns the unique name of the cached path in
+// the cache directory.
+func name(path *engine.CachePath) string {
+	h := sha256.Sum256([]byte(path.Name))
+	return hex.EncodeToString(h[:])[:16]
+}
+
+// helper function resolves the symbolic links in the cached
+// path, and returns an error if the resolved path is not within
+// one of the cache root directories. The cache is restored and
+// saved by the runner user, and the workspace is controlled by
+// the pipeline, so the cached path must not be resolved outside
+// of the workspace. The last path element is not resolved,
+// since symbolic links are cached as links.
+func resolve(cache *engine.Cache, path string) (string, error) {
+	parent, err := evalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	resolved := filepath.Join(parent, filepath.Base(path))
+	for _, root := range cache.Roots {
+		root, err := evalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if resolved == root || strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("cache: path %s is outside of the workspace", path)
+}
+
+// helper function resolves the symbolic links in the path. The
+// path may not exist, in which case the symbolic links in the
+// nearest existing parent directory are resolved.
+func evalSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		resolved, err = evalSymlinks(parent)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(resolved, filepath.Base(path)), nil
+	}
+	return resolved, err
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+func TestSaveRestore(t *testing.T) {
+	dir := t.TempDir()
+	workspace := filepath.Join(dir, "workspace")
+	modules := filepath.Join(workspace, "node_modules")
+	os.MkdirAll(filepath.Join(modules, "left-pad"), 0755)
+	ioutil.WriteFile(filepath.Join(modules, "left-pad", "index.js"), []byte("module.exports = {}"), 0644)
+	os.Symlink("left-pad/index.js", filepath.Join(modules, "index.js"))
+
+	spec := &engine.Spec{
+		Cache: &engine.Cache{
+			Dir: filepath.Join(dir, "cache"),
+			Key: "deps",
+			Paths: []*engine.CachePath{
+				{Name: "node_modules", Path: modules},
+				{Name: "vendor", Path: filepath.Join(workspace, "vendor")},
+			},
+			Roots: []string{workspace},
+		},
+	}
+	if err := Save(spec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	os.RemoveAll(workspace)
+	if err := Restore(spec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(modules, "left-pad", "index.js"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := string(raw), "module.exports = {}"; got != want {
+		t.Errorf("Want restored file contents %q, got %q", want, got)
+	}
+	if link, _ := os.Readlink(filepath.Join(modules, "index.js")); link != "left-pad/index.js" {
+		t.Errorf("Want restored symbolic link, got %q", link)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "vendor")); !os.IsNotExist(err) {
+		t.Errorf("Want missing paths ignored")
+	}
+}
+
+// This test verifies that the cached paths cannot be resolved
+// outside of the workspace through symbolic links.
+func TestSaveRestore_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	workspace := filepath.Join(dir, "workspace")
+	outside := filepath.Join(dir, "outside")
+	os.MkdirAll(workspace, 0755)
+	os.MkdirAll(filepath.Join(outside, "node_modules"), 0755)
+	ioutil.WriteFile(filepath.Join(outside, "node_modules", "secret"), []byte("correct-horse-battery-staple"), 0600)
+	os.Symlink(outside, filepath.Join(workspace, "link"))
+
+	spec := &engine.Spec{
+		Cache: &engine.Cache{
+			Dir: filepath.Join(dir, "cache"),
+			Key: "deps",
+			Paths: []*engine.CachePath{
+				{Name: "link/node_modules", Path: filepath.Join(workspace, "link", "node_modules")},
+			},
+			Roots: []string{workspace},
+		},
+	}
+	if err := Save(spec); err == nil {
+		t.Errorf("Want error saving path outside of the workspace")
+	}
+
+	// the path is saved while it is within the workspace, and
+	// restored after it is replaced with a symbolic link.
+	os.Remove(filepath.Join(workspace, "link"))
+	os.MkdirAll(filepath.Join(workspace, "link", "node_modules"), 0755)
+	if err := Save(spec); err != nil {
+		t.Error(err)
+		return
+	}
+	os.RemoveAll(filepath.Join(workspace, "link"))
+	os.Symlink(outside, filepath.Join(workspace, "link"))
+	if err := Restore(spec); err == nil {
+		t.Errorf("Want error restoring path outside of the workspace")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "node_modules", "secret")); err != nil {
+		t.Errorf("Want files outside of the workspace unchanged")
+	}
+}
+
+func TestRestore_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	spec := &engine.Spec{
+		Cache: &engine.Cache{
+			Dir: filepath.Join(dir, "cache"),
+			Paths: []*engine.CachePath{
+				{Name: "node_modules", Path: filepath.Join(dir, "node_modules")},
+			},
+		},
+	}
+	if err := Restore(spec); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "node_modules")); !os.IsNotExist(err) {
+		t.Errorf("Want nothing restored when cache is empty")
+	}
+}
+
+func TestKey(t *testing.T) {
+	dir := t.TempDir()
+	gosum := filepath.Join(dir, "go.sum")
+
+	cache := &engine.Cache{Roots: []string{dir}}
+	if got, want := Key(cache), "default"; got != want {
+		t.Errorf("Want default key %q, got %q", want, got)
+	}
+
+	cache.Key = "Go Modules"
+	if got, want := Key(cache), "go-modules"; got != want {
+		t.Errorf("Want key %q, got %q", want, got)
+	}
+
+	cache.Hash = []string{gosum}
+	ioutil.WriteFile(gosum, []byte("v1"), 0644)
+	before := Key(cache)
+	if !strings.HasPrefix(before, "go-modules-") {
+		t.Errorf("Want checksum appended to key, got %q", before)
+	}
+	if got := Key(cache); got != before {
+		t.Errorf("Want stable key, got %q and %q", before, got)
+	}
+
+	ioutil.WriteFile(gosum, []byte("v2"), 0644)
+	after := Key(cache)
+	if after == before {
+		t.Errorf("Want key changed when hash file changes")
+	}
+
+	// hash files outside of the workspace are ignored.
+	cache.Roots = []string{filepath.Join(dir, "workspace")}
+	if got := Key(cache); got == after {
+		t.Errorf("Want hash file outside of the workspace ignored")
+	}
+}
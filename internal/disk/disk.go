@@ -0,0 +1,95 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package disk provides the free disk space of a filesystem.
+package disk
+
+import (
+	"fmt"
+
+	"github.com/docker/go-units"
+)
+
+// Usage describes the free space of a filesystem.
+type Usage struct {
+	// Free is the free space, in bytes, available to
+	// unprivileged users.
+	Free uint64
+
+	// Inodes is the number of free inodes.
+	Inodes uint64
+
+	// Files is the total number of inodes. Files is zero if
+	// the filesystem does not report inodes.
+	Files uint64
+}
+
+// Stat returns the free space of the filesystem that contains
+// the named path.
+func Stat(path string) (*Usage, error) {
+	return stat(path)
+}
+
+// Guard checks the filesystem has the minimum free disk space
+// and inodes.
+type Guard struct {
+	// Path is a path in the filesystem.
+	Path string
+
+	// MinFree is the minimum free disk space, in bytes. If
+	// zero, free disk space is not checked.
+	MinFree int64
+
+	// MinInodes is the minimum number of free inodes. If zero,
+	// or if the filesystem does not report inodes, free inodes
+	// are not checked.
+	MinInodes int64
+}
+
+// Check returns an error if the filesystem is below the minimum
+// free disk space or inodes.
+func (g *Guard) Check() error {
+	if g.MinFree <= 0 && g.MinInodes <= 0 {
+		return nil
+	}
+	usage, err := Stat(g.Path)
+	if err != nil {
+		return &guardError{
+			reason: "cannot check free disk space",
+			msg:    fmt.Sprintf("cannot check free disk space: %s", err),
+		}
+	}
+	if g.MinFree > 0 && usage.Free < uint64(g.MinFree) {
+		return &guardError{
+			reason: "low disk space",
+			msg: fmt.Sprintf("free disk space %s is below %s",
+				units.BytesSize(float64(usage.Free)),
+				units.BytesSize(float64(g.MinFree)),
+			),
+		}
+	}
+	if g.MinInodes > 0 && usage.Files > 0 && usage.Inodes < uint64(g.MinInodes) {
+		return &guardError{
+			reason: "low inodes",
+			msg: fmt.Sprintf("free inodes %d is below %d",
+				usage.Inodes,
+				g.MinInodes,
+			),
+		}
+	}
+	return nil
+}
+
+// guardError is returned when the filesystem is below the
+// minimum free disk space or inodes.
+type guardError struct {
+	reason string
+	msg    string
+}
+
+func (e *guardError) Error() string { return e.msg }
+
+// Reason returns the reason the check failed, without the
+// current free disk space or inodes.
+func (e *guardError) Reason() string { return e.reason }
@@ -0,0 +1,13 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux,!darwin,!freebsd,!windows
+
+package disk
+
+import "errors"
+
+func stat(path string) (*Usage, error) {
+	return nil, errors.New("disk usage is not supported")
+}
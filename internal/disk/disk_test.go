@@ -0,0 +1,55 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package disk
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	usage, err := Stat(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Free == 0 {
+		t.Errorf("Want free disk space reported")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	dir := t.TempDir()
+
+	g := &Guard{Path: dir, MinFree: 1}
+	if err := g.Check(); err != nil {
+		t.Errorf("Want no error when above the minimum, got %s", err)
+	}
+
+	g = &Guard{Path: dir, MinFree: math.MaxInt64}
+	err := g.Check()
+	if err == nil || !strings.Contains(err.Error(), "free disk space") {
+		t.Errorf("Want free disk space error, got %v", err)
+	}
+	if r, ok := err.(interface{ Reason() string }); !ok || r.Reason() != "low disk space" {
+		t.Errorf("Want stable reason without the free disk space")
+	}
+
+	usage, _ := Stat(dir)
+	if usage.Files == 0 {
+		t.Skip("filesystem does not report inodes")
+	}
+	g = &Guard{Path: dir, MinInodes: math.MaxInt64}
+	if err := g.Check(); err == nil || !strings.Contains(err.Error(), "free inodes") {
+		t.Errorf("Want free inodes error, got %v", err)
+	}
+}
+
+func TestGuard_Disabled(t *testing.T) {
+	g := &Guard{Path: "/path/does/not/exist"}
+	if err := g.Check(); err != nil {
+		t.Errorf("Want no error when disabled, got %s", err)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux darwin freebsd
+
+package disk
+
+import "syscall"
+
+func stat(path string) (*Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+	return &Usage{
+		Free:   uint64(st.Bavail) * uint64(st.Bsize),
+		Inodes: uint64(st.Ffree),
+		Files:  uint64(st.Files),
+	}, nil
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package disk
+
+import "golang.org/x/sys/windows"
+
+func stat(path string) (*Usage, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var free, total, totalFree uint64
+	err = windows.GetDiskFreeSpaceEx(name, &free, &total, &totalFree)
+	if err != nil {
+		return nil, err
+	}
+	return &Usage{Free: free}, nil
+}
@@ -0,0 +1,7 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package filelock provides exclusive locks that are shared by
+// concurrent pipelines on the host machine.
+package filelock
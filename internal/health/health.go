@@ -0,0 +1,168 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package health provides the runner health and readiness
+// checks.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+// errNoContact is returned if the runner has not contacted the
+// server.
+var errNoContact = errors.New("server not contacted")
+
+// Checker checks the readiness of the runner.
+type Checker struct {
+	// Root is the root directory of the pipeline workspaces.
+	Root string
+
+	// Guard returns an error if the runner is paused, for
+	// example, if the host is low on disk space.
+	Guard func() error
+
+	mu  sync.Mutex
+	err error
+}
+
+// New returns a new readiness checker. The runner is not ready
+// until the server is contacted.
+func New(root string, guard func() error) *Checker {
+	return &Checker{
+		Root:  root,
+		Guard: guard,
+		err:   errNoContact,
+	}
+}
+
+// Report records the result of the last round-trip to the
+// server.
+func (c *Checker) Report(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+// Check returns the reasons the runner is not ready, if any.
+func (c *Checker) Check() []string {
+	var reasons []string
+
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		reasons = append(reasons, fmt.Sprintf("cannot contact the server: %s", err))
+	}
+
+	if err := writable(c.Root); err != nil {
+		reasons = append(reasons, fmt.Sprintf("root directory is not writable: %s", err))
+	}
+
+	if c.Guard != nil {
+		if err := c.Guard(); err != nil {
+			reasons = append(reasons, fmt.Sprintf("runner paused: %s", err))
+		}
+	}
+	return reasons
+}
+
+// Ping pings the server at the given interval and records the
+// result. Ping blocks until the context is cancelled.
+func (c *Checker) Ping(ctx context.Context, cli client.Client, machine string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := cli.Ping(ctx, machine)
+		if ctx.Err() == nil {
+			c.Report(err)
+		}
+	}
+}
+
+// Client returns a client that records the result of each
+// ping and request round-trip to the server.
+func (c *Checker) Client(cli client.Client) client.Client {
+	return &reporter{Client: cli, checker: c}
+}
+
+// HandleHealth returns an http.HandlerFunc that reports the
+// runner is alive.
+func HandleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK\n"))
+	}
+}
+
+// HandleReady returns an http.HandlerFunc that reports whether
+// the runner is ready to execute pipelines.
+func HandleReady(c *Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		reasons := c.Check()
+		if len(reasons) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(strings.Join(reasons, "\n") + "\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK\n"))
+	}
+}
+
+// reporter is a client that records the result of round-trips
+// to the server.
+type reporter struct {
+	client.Client
+	checker *Checker
+}
+
+func (r *reporter) Ping(ctx context.Context, machine string) error {
+	err := r.Client.Ping(ctx, machine)
+	if ctx.Err() == nil {
+		r.checker.Report(err)
+	}
+	return err
+}
+
+func (r *reporter) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	stage, err := r.Client.Request(ctx, args)
+	if ctx.Err() == nil {
+		r.checker.Report(err)
+	}
+	return stage, err
+}
+
+// helper function returns an error if a file cannot be written
+// to the directory. The directory is created if it does not
+// exist, since the runner creates the directory on demand.
+func writable(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".drone-ready-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestCheck(t *testing.T) {
+	c := New(t.TempDir(), nil)
+	if reasons := c.Check(); len(reasons) != 1 {
+		t.Errorf("Want not ready until the server is contacted, got %v", reasons)
+	}
+
+	cli := c.Client(&stubClient{})
+	cli.Ping(context.Background(), "localhost")
+	if reasons := c.Check(); len(reasons) != 0 {
+		t.Errorf("Want ready after successful ping, got %v", reasons)
+	}
+
+	cli = c.Client(&stubClient{err: errors.New("connection refused")})
+	cli.Ping(context.Background(), "localhost")
+	reasons := c.Check()
+	if len(reasons) != 1 || !strings.Contains(reasons[0], "connection refused") {
+		t.Errorf("Want not ready after failed ping, got %v", reasons)
+	}
+}
+
+func TestCheck_Cancelled(t *testing.T) {
+	c := New(t.TempDir(), nil)
+	c.Report(nil)
+
+	// a request cancelled by the runner is not a failed
+	// round-trip to the server.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Client(&stubClient{err: context.Canceled}).Request(ctx, nil)
+	if reasons := c.Check(); len(reasons) != 0 {
+		t.Errorf("Want ready after cancelled request, got %v", reasons)
+	}
+}
+
+func TestCheck_Paused(t *testing.T) {
+	c := New(t.TempDir(), func() error {
+		return errors.New("free disk space 1GiB is below 2GiB")
+	})
+	c.Report(nil)
+	reasons := c.Check()
+	if len(reasons) != 1 || !strings.Contains(reasons[0], "runner paused: free disk space") {
+		t.Errorf("Want not ready when paused, got %v", reasons)
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	c := New(t.TempDir(), nil)
+
+	w := httptest.NewRecorder()
+	HandleReady(c).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if got, want := w.Code, 503; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	c.Report(nil)
+	w = httptest.NewRecorder()
+	HandleReady(c).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
+
+// stubClient is a client that returns the configured error.
+type stubClient struct {
+	client.Client
+	err error
+}
+
+func (c *stubClient) Ping(ctx context.Context, machine string) error {
+	return c.err
+}
+
+func (c *stubClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	return nil, c.err
+}
@@ -0,0 +1,237 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package janitor removes pipeline workspaces that are no longer
+// needed from the host machine.
+package janitor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// Janitor removes kept workspaces when they expire, or when the
+// kept workspaces exceed the disk budget. The janitor also removes
+// orphaned workspaces, created by a runner process that exited
+// before the pipeline completed.
+type Janitor struct {
+	// Root is the root directory of the pipeline workspaces.
+	Root string
+
+	// TTL is the duration a kept workspace is retained before
+	// it is removed. If zero, workspaces do not expire.
+	TTL time.Duration
+
+	// Budget is the maximum disk space, in bytes, used by the
+	// kept workspaces. The oldest workspaces are removed when
+	// the budget is exceeded. If zero, the budget is unlimited.
+	Budget int64
+}
+
+// Start starts the janitor, collecting workspaces immediately
+// and then at the given interval. Start blocks until the context
+// is cancelled.
+func (j *Janitor) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		j.CollectOrphans(ctx)
+		j.Collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect removes the kept workspaces that are expired or exceed
+// the disk budget, and returns the disk space reclaimed.
+func (j *Janitor) Collect(ctx context.Context) (int64, error) {
+	log := logger.FromContext(ctx)
+
+	var reclaimed int64
+	err := update(j.Root, func(entries []*Entry) []*Entry {
+		now := time.Now()
+
+		var kept []*Entry
+		var sizes []int64
+		var total int64
+		for _, entry := range entries {
+			size, err := du(entry.Path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			expired := j.TTL > 0 &&
+				now.Sub(time.Unix(entry.Created, 0)) > j.TTL
+			if expired && remove(ctx, entry) {
+				reclaimed += size
+				continue
+			}
+			kept = append(kept, entry)
+			sizes = append(sizes, size)
+			total += size
+		}
+
+		if j.Budget <= 0 {
+			return kept
+		}
+
+		// the entries are sorted by creation date so that the
+		// oldest workspaces are removed first.
+		sort.Stable(byCreated{kept, sizes})
+		for len(kept) > 0 && total > j.Budget {
+			if remove(ctx, kept[0]) {
+				reclaimed += sizes[0]
+			}
+			total -= sizes[0]
+			kept, sizes = kept[1:], sizes[1:]
+		}
+		return kept
+	})
+	if err != nil {
+		log.WithError(err).
+			Warnln("cannot collect the kept workspaces")
+		return reclaimed, err
+	}
+	if reclaimed > 0 {
+		log.WithField("reclaimed", reclaimed).
+			Infoln("removed kept workspaces")
+	}
+	return reclaimed, nil
+}
+
+// CollectOrphans removes the orphaned workspaces and returns the
+// disk space reclaimed. A workspace is orphaned if the process
+// that created the workspace is no longer running. Kept
+// workspaces, and directories not created by the runner, are
+// ignored.
+func (j *Janitor) CollectOrphans(ctx context.Context) (int64, error) {
+	log := logger.FromContext(ctx)
+
+	kept := map[string]bool{}
+	entries, err := List(j.Root)
+	if err != nil {
+		log.WithError(err).
+			Warnln("cannot list the kept workspaces")
+		return 0, err
+	}
+	for _, entry := range entries {
+		kept[entry.Path] = true
+	}
+
+	files, err := ioutil.ReadDir(j.Root)
+	if err != nil {
+		log.WithError(err).
+			Warnln("cannot list the workspaces")
+		return 0, err
+	}
+
+	var reclaimed int64
+	for _, file := range files {
+		path := filepath.Join(j.Root, file.Name())
+		if !file.IsDir() || !strings.HasPrefix(file.Name(), "drone-") || kept[path] {
+			continue
+		}
+		// directories without a marker file were not created
+		// by the runner (for example, the workspace cache) and
+		// are never removed.
+		marker, err := readMarker(path)
+		if err != nil || marker.alive() {
+			continue
+		}
+		size, _ := du(path)
+		if err := os.RemoveAll(path); err != nil {
+			log.WithError(err).
+				WithField("path", path).
+				Warnln("cannot remove orphaned workspace")
+			continue
+		}
+		log.WithField("path", path).
+			WithField("pid", marker.Pid).
+			Debugln("removed orphaned workspace")
+		reclaimed += size
+	}
+	if reclaimed > 0 {
+		log.WithField("reclaimed", reclaimed).
+			Infoln("removed orphaned workspaces")
+	}
+	return reclaimed, nil
+}
+
+// Usage returns the disk space used by the workspaces in the
+// root directory, including kept and orphaned workspaces.
+func Usage(root string) int64 {
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, file := range files {
+		path := filepath.Join(root, file.Name())
+		if !file.IsDir() || !strings.HasPrefix(file.Name(), "drone-") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, markerName)); err != nil {
+			continue
+		}
+		size, _ := du(path)
+		total += size
+	}
+	return total
+}
+
+// helper function removes the kept workspace and returns true
+// if successful.
+func remove(ctx context.Context, entry *Entry) bool {
+	log := logger.FromContext(ctx).
+		WithField("path", entry.Path)
+	if err := os.RemoveAll(entry.Path); err != nil {
+		log.WithError(err).
+			Warnln("cannot remove kept workspace")
+		return false
+	}
+	log.Debugln("removed kept workspace")
+	return true
+}
+
+// helper function returns the disk space used by the files in
+// the directory tree. Files that cannot be read are ignored.
+func du(path string) (int64, error) {
+	if _, err := os.Lstat(path); err != nil {
+		return 0, err
+	}
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, nil
+}
+
+// byCreated sorts the entries and sizes by creation date.
+type byCreated struct {
+	entries []*Entry
+	sizes   []int64
+}
+
+func (s byCreated) Len() int { return len(s.entries) }
+
+func (s byCreated) Less(i, j int) bool {
+	return s.entries[i].Created < s.entries[j].Created
+}
+
+func (s byCreated) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.sizes[i], s.sizes[j] = s.sizes[j], s.sizes[i]
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollect_TTL(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	expired := mkworkspace(t, root, "drone-expired", 10)
+	current := mkworkspace(t, root, "drone-current", 10)
+	Record(root, &Entry{Path: expired, Created: now.Add(-2 * time.Hour).Unix()})
+	Record(root, &Entry{Path: current, Created: now.Unix()})
+	Record(root, &Entry{Path: filepath.Join(root, "drone-missing"), Created: now.Unix()})
+
+	janitor := &Janitor{Root: root, TTL: time.Hour}
+	reclaimed, err := janitor.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed < 10 {
+		t.Errorf("Want at least 10 bytes reclaimed, got %d", reclaimed)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("Want expired workspace removed")
+	}
+	if _, err := os.Stat(current); err != nil {
+		t.Errorf("Want current workspace kept")
+	}
+
+	entries, err := List(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != current {
+		t.Errorf("Want manifest to list the current workspace only, got %v", entries)
+	}
+}
+
+func TestCollect_Budget(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	oldest := mkworkspace(t, root, "drone-oldest", 100)
+	older := mkworkspace(t, root, "drone-older", 100)
+	newest := mkworkspace(t, root, "drone-newest", 100)
+	Record(root, &Entry{Path: newest, Created: now.Unix()})
+	Record(root, &Entry{Path: oldest, Created: now.Add(-2 * time.Minute).Unix()})
+	Record(root, &Entry{Path: older, Created: now.Add(-time.Minute).Unix()})
+
+	// the budget is sized to fit a single workspace, including
+	// the size of the directory entries.
+	size, _ := du(newest)
+	janitor := &Janitor{Root: root, Budget: size + size/2}
+	if _, err := janitor.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{oldest, older} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Want workspace %s removed", filepath.Base(path))
+		}
+	}
+	if _, err := os.Stat(newest); err != nil {
+		t.Errorf("Want newest workspace kept")
+	}
+}
+
+func TestCollectOrphans(t *testing.T) {
+	root := t.TempDir()
+	orphan := mkworkspace(t, root, "drone-orphan", 10)
+	running := mkworkspace(t, root, "drone-running", 10)
+	kept := mkworkspace(t, root, "drone-kept", 10)
+	cache := mkworkspace(t, root, "drone-cache", 10)
+
+	// the orphaned and kept workspaces were created by a
+	// process before the host machine was rebooted.
+	stale, _ := json.Marshal(&marker{Pid: os.Getpid(), Boot: "previous-boot"})
+	ioutil.WriteFile(filepath.Join(orphan, markerName), stale, 0600)
+	ioutil.WriteFile(filepath.Join(kept, markerName), stale, 0600)
+	if err := Mark(running); err != nil {
+		t.Fatal(err)
+	}
+	Record(root, &Entry{Path: kept, Created: time.Now().Unix()})
+
+	janitor := &Janitor{Root: root}
+	reclaimed, err := janitor.CollectOrphans(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed < 10 {
+		t.Errorf("Want at least 10 bytes reclaimed, got %d", reclaimed)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("Want orphaned workspace removed")
+	}
+	for _, path := range []string{running, kept, cache} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Want workspace %s not removed", filepath.Base(path))
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	root := t.TempDir()
+	workspace := mkworkspace(t, root, "drone-workspace", 100)
+	mkworkspace(t, root, "drone-cache", 1000)
+	Mark(workspace)
+
+	size, _ := du(workspace)
+	if got := Usage(root); got != size {
+		t.Errorf("Want usage %d, got %d", size, got)
+	}
+}
+
+func TestList_Empty(t *testing.T) {
+	entries, err := List(t.TempDir())
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Want empty manifest")
+	}
+}
+
+func mkworkspace(t *testing.T, root, name string, size int) string {
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Join(path, "drone", "src"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, size)
+	if err := ioutil.WriteFile(filepath.Join(path, "drone", "src", "main.go"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
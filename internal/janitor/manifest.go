@@ -0,0 +1,100 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package janitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone-runners/drone-runner-exec/internal/filelock"
+)
+
+// name of the manifest file, in the root directory, that lists
+// the kept workspaces.
+const manifestName = "drone-workspaces.json"
+
+// Entry describes a kept workspace.
+type Entry struct {
+	Path    string `json:"path"`
+	Repo    string `json:"repo,omitempty"`
+	Build   int64  `json:"build,omitempty"`
+	Stage   string `json:"stage,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Created int64  `json:"created"`
+}
+
+// Record adds the kept workspace to the manifest in the root
+// directory.
+func Record(root string, entry *Entry) error {
+	return update(root, func(entries []*Entry) []*Entry {
+		return append(entries, entry)
+	})
+}
+
+// List returns the kept workspaces recorded in the manifest in
+// the root directory.
+func List(root string) ([]*Entry, error) {
+	path := filepath.Join(root, manifestName)
+	unlock, err := filelock.Lock(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return read(path)
+}
+
+// helper function reads the manifest, applies the update
+// function, and writes the manifest. The manifest is locked to
+// prevent concurrent updates by pipelines executing in parallel.
+func update(root string, fn func([]*Entry) []*Entry) error {
+	path := filepath.Join(root, manifestName)
+	unlock, err := filelock.Lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := read(path)
+	if err != nil {
+		return err
+	}
+
+	// the manifest is not written if there are no kept
+	// workspaces and the manifest was empty.
+	updated := fn(entries)
+	if len(entries) == 0 && len(updated) == 0 {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the manifest is written to a temporary file and renamed
+	// so that a partial write does not corrupt the manifest.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// helper function reads the manifest. A missing manifest is
+// treated as an empty manifest.
+func read(path string) ([]*Entry, error) {
+	var entries []*Entry
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &entries)
+	return entries, err
+}
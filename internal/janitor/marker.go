@@ -0,0 +1,66 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package janitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// name of the marker file, in the stage root directory, that
+// identifies the directory as created by the runner.
+const markerName = ".drone-stage.json"
+
+// marker identifies the process that owns a stage root
+// directory.
+type marker struct {
+	Pid     int    `json:"pid"`
+	Boot    string `json:"boot,omitempty"`
+	Created int64  `json:"created"`
+}
+
+// Mark writes the marker file to the stage root directory,
+// identifying the current process as the owner.
+func Mark(root string) error {
+	raw, _ := json.Marshal(&marker{
+		Pid:     os.Getpid(),
+		Boot:    bootID(),
+		Created: time.Now().Unix(),
+	})
+	return ioutil.WriteFile(filepath.Join(root, markerName), raw, 0600)
+}
+
+// helper function reads the marker file from the stage root
+// directory.
+func readMarker(root string) (*marker, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(root, markerName))
+	if err != nil {
+		return nil, err
+	}
+	m := new(marker)
+	err = json.Unmarshal(raw, m)
+	return m, err
+}
+
+// helper function returns true if the process that owns the
+// stage root directory is running. A process identifier from a
+// previous boot may have been reused, and is therefore ignored.
+func (m *marker) alive() bool {
+	if m.Boot != bootID() {
+		return false
+	}
+	return running(m.Pid)
+}
+
+// helper function returns the unique identifier of the current
+// boot, if supported by the operating system.
+func bootID() string {
+	raw, _ := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	return strings.TrimSpace(string(raw))
+}
@@ -0,0 +1,19 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package janitor
+
+import "os"
+
+// helper function returns true if the process is running. On
+// windows, finding the process fails if the process does not
+// exist.
+func running(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	proc.Release()
+	return true
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package load limits the pipeline stages executed by the runner
+// based on the load of the host machine.
+package load
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errNotSupported is returned if the host load cannot be
+// measured on the current operating system.
+var errNotSupported = errors.New("not supported")
+
+// Limiter limits the pipeline stages executed by the runner
+// based on the load of the host machine. A limit that is zero,
+// or that cannot be measured on the host, is not enforced.
+type Limiter struct {
+	// MaxLoad is the maximum one minute load average.
+	MaxLoad float64
+
+	// MaxMemoryPressure is the maximum percentage of time, over
+	// the last ten seconds, that tasks were stalled waiting for
+	// memory (linux pressure stall information).
+	MaxMemoryPressure float64
+
+	// MaxCPU is the maximum cpu usage, as a percentage of all
+	// cpus.
+	MaxCPU float64
+
+	// Settle is the minimum duration between admitted stages.
+	// The host load does not immediately reflect a new stage,
+	// and the settle period prevents the runner from admitting
+	// multiple stages before the load is measured.
+	Settle time.Duration
+
+	mu       sync.Mutex
+	admitted time.Time
+	cpu      sample
+	usage    float64
+}
+
+// Enabled returns true if a limit is configured.
+func (l *Limiter) Enabled() bool {
+	return l.MaxLoad > 0 || l.MaxMemoryPressure > 0 || l.MaxCPU > 0
+}
+
+// Check returns an error if the host load exceeds a limit, or if
+// a stage was admitted within the settle period.
+func (l *Limiter) Check() error {
+	if !l.Enabled() {
+		return nil
+	}
+	if l.MaxLoad > 0 {
+		if v, err := loadavg(); err == nil && v > l.MaxLoad {
+			return &limitError{
+				reason: "high load average",
+				msg:    fmt.Sprintf("load average %.2f is above %.2f", v, l.MaxLoad),
+			}
+		}
+	}
+	if l.MaxMemoryPressure > 0 {
+		if v, err := memoryPressure(); err == nil && v > l.MaxMemoryPressure {
+			return &limitError{
+				reason: "high memory pressure",
+				msg:    fmt.Sprintf("memory pressure %.2f%% is above %.2f%%", v, l.MaxMemoryPressure),
+			}
+		}
+	}
+	if l.MaxCPU > 0 {
+		if v, err := l.cpuUsage(); err == nil && v > l.MaxCPU {
+			return &limitError{
+				reason: "high cpu usage",
+				msg:    fmt.Sprintf("cpu usage %.2f%% is above %.2f%%", v, l.MaxCPU),
+			}
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.settling()
+}
+
+// Admit returns an error if the host load exceeds a limit, or
+// if a stage was admitted within the settle period. Otherwise
+// the stage is admitted.
+func (l *Limiter) Admit() error {
+	if err := l.Check(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the settle period is checked again, since a stage may be
+	// admitted concurrently.
+	if err := l.settling(); err != nil {
+		return err
+	}
+	if l.Enabled() {
+		l.admitted = time.Now()
+	}
+	return nil
+}
+
+// helper function returns an error if a stage was admitted
+// within the settle period. The caller must hold the lock.
+func (l *Limiter) settling() error {
+	if since := time.Since(l.admitted); since < l.Settle {
+		return &limitError{
+			reason: "waiting for the load to settle",
+			msg:    fmt.Sprintf("stage admitted %s ago, waiting for the load to settle", since.Round(time.Second)),
+		}
+	}
+	return nil
+}
+
+// limitError is returned when the host load exceeds a limit, or
+// a stage was admitted within the settle period.
+type limitError struct {
+	reason string
+	msg    string
+}
+
+func (e *limitError) Error() string { return e.msg }
+
+// Reason returns the reason the stage is not admitted, without
+// the current host load.
+func (e *limitError) Reason() string { return e.reason }
+
+// helper function returns the cpu usage, as a percentage, since
+// the previous sample. The usage is recomputed at most once per
+// second, and is zero until two samples are taken.
+func (l *Limiter) cpuUsage() (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.cpu.time) < time.Second {
+		return l.usage, nil
+	}
+	next, err := cpuSample()
+	if err != nil {
+		return 0, err
+	}
+	if total := next.total - l.cpu.total; l.cpu.total != 0 && total > 0 {
+		idle := next.idle - l.cpu.idle
+		l.usage = 100 * float64(total-idle) / float64(total)
+	}
+	l.cpu = next
+	return l.usage, nil
+}
+
+// sample is a sample of the cumulative cpu time.
+type sample struct {
+	time  time.Time
+	total uint64
+	idle  uint64
+}
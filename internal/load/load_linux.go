@@ -0,0 +1,88 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procfs is the mount point of the proc filesystem.
+var procfs = "/proc"
+
+// helper function returns the one minute load average.
+func loadavg() (float64, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(procfs, "loadavg"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, errors.New("malformed loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// helper function returns the percentage of time, over the last
+// ten seconds, that some tasks were stalled waiting for memory.
+func memoryPressure() (float64, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(procfs, "pressure", "memory"))
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				return strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			}
+		}
+	}
+	return 0, errors.New("malformed memory pressure")
+}
+
+// helper function returns a sample of the cumulative cpu time.
+func cpuSample() (sample, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(procfs, "stat"))
+	if err != nil {
+		return sample{}, err
+	}
+	line := raw
+	if i := bytes.IndexByte(raw, '\n'); i != -1 {
+		line = raw[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return sample{}, errors.New("malformed stat")
+	}
+	s := sample{time: time.Now()}
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return sample{}, err
+		}
+		// the guest and guest_nice fields are included in the
+		// user and nice fields, and are not counted twice.
+		if i >= 8 {
+			break
+		}
+		s.total += v
+		// the idle and iowait fields.
+		if i == 3 || i == 4 {
+			s.idle += v
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package load
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	fakeProcfs(t, "4.50 3.00 2.00 1/100 1234", "some avg10=12.50 avg60=1.00 avg300=0.00 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+
+	tests := []struct {
+		limiter *Limiter
+		want    string
+	}{
+		{&Limiter{}, ""},
+		{&Limiter{MaxLoad: 8}, ""},
+		{&Limiter{MaxLoad: 4}, "load average 4.50 is above 4.00"},
+		{&Limiter{MaxMemoryPressure: 20}, ""},
+		{&Limiter{MaxMemoryPressure: 10}, "memory pressure 12.50% is above 10.00%"},
+	}
+	for _, test := range tests {
+		err := test.limiter.Check()
+		if test.want == "" && err != nil {
+			t.Errorf("Want no error, got %s", err)
+		}
+		if test.want != "" && (err == nil || err.Error() != test.want) {
+			t.Errorf("Want error %q, got %v", test.want, err)
+		}
+	}
+}
+
+func TestCheck_CPU(t *testing.T) {
+	dir := fakeProcfs(t, "0.00 0.00 0.00 1/100 1234", "")
+	writeStat := func(user, idle int) {
+		stat := "cpu  " + strconv.Itoa(user) + " 0 0 " + strconv.Itoa(idle) + " 0 0 0 0 0 0\ncpu0 1 2 3 4\n"
+		ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+	}
+
+	l := &Limiter{MaxCPU: 50}
+	writeStat(100, 100)
+	if err := l.Check(); err != nil {
+		t.Errorf("Want no error before cpu usage is sampled, got %s", err)
+	}
+
+	// the cpu usage is computed from the difference between
+	// the two samples, where 90 of 100 ticks were busy.
+	l.cpu.time = time.Now().Add(-time.Minute)
+	writeStat(190, 110)
+	err := l.Check()
+	if err == nil || !strings.HasPrefix(err.Error(), "cpu usage 90.00%") {
+		t.Errorf("Want cpu usage error, got %v", err)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	fakeProcfs(t, "1.00 1.00 1.00 1/100 1234", "")
+
+	l := &Limiter{MaxLoad: 4, Settle: time.Hour}
+	if err := l.Admit(); err != nil {
+		t.Errorf("Want first stage admitted, got %s", err)
+	}
+	if err := l.Admit(); err == nil {
+		t.Errorf("Want second stage refused during the settle period")
+	}
+	err := l.Check()
+	if err == nil {
+		t.Errorf("Want polling paused during the settle period")
+	}
+	if r, ok := err.(interface{ Reason() string }); !ok || r.Reason() != "waiting for the load to settle" {
+		t.Errorf("Want stable reason without the time since the stage was admitted")
+	}
+
+	l = &Limiter{Settle: time.Hour}
+	l.Admit()
+	if err := l.Admit(); err != nil {
+		t.Errorf("Want stages admitted when no limits are configured, got %s", err)
+	}
+}
+
+func fakeProcfs(t *testing.T, loadavg, pressure string) string {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "pressure"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "loadavg"), []byte(loadavg), 0644)
+	if pressure != "" {
+		ioutil.WriteFile(filepath.Join(dir, "pressure", "memory"), []byte(pressure), 0644)
+	}
+	procfs = dir
+	t.Cleanup(func() {
+		procfs = "/proc"
+	})
+	return dir
+}
@@ -0,0 +1,19 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package load
+
+func loadavg() (float64, error) {
+	return 0, errNotSupported
+}
+
+func memoryPressure() (float64, error) {
+	return 0, errNotSupported
+}
+
+func cpuSample() (sample, error) {
+	return sample{}, errNotSupported
+}
@@ -36,6 +36,22 @@ func Func(repos, events []string, trusted bool) func(*drone.Repo, *drone.Build)
 	}
 }
 
+// Any returns a new match function that returns true if the
+// repository is trusted and trusted mode is enabled, or if the
+// repository name matches any of the patterns. Unlike Func, no
+// repositories match if no patterns are defined.
+func Any(repos []string, trusted bool) func(*drone.Repo, *drone.Build) bool {
+	return func(repo *drone.Repo, build *drone.Build) bool {
+		if trusted && repo.Trusted {
+			return true
+		}
+		if len(repos) == 0 {
+			return false
+		}
+		return match(repo.Slug, repos)
+	}
+}
+
 func match(s string, patterns []string) bool {
 	// if no matching patterns are defined the string
 	// is always considered a match.
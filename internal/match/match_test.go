@@ -123,3 +123,50 @@ func TestFunc(t *testing.T) {
 		}
 	}
 }
+
+func TestAny(t *testing.T) {
+	tests := []struct {
+		repo    string
+		trusted bool
+		match   bool
+		matcher func(*drone.Repo, *drone.Build) bool
+	}{
+		{
+			repo:    "octocat/hello-world",
+			match:   true,
+			matcher: Any([]string{"spaceghost/*", "octocat/*"}, false),
+		},
+		{
+			repo:    "octocat/hello-world",
+			trusted: true,
+			match:   true,
+			matcher: Any([]string{}, true),
+		},
+		{
+			repo:    "octocat/hello-world",
+			match:   false,
+			matcher: Any([]string{}, true),
+		},
+		{
+			repo:    "octocat/hello-world",
+			trusted: true,
+			match:   false,
+			matcher: Any([]string{}, false),
+		},
+		{
+			repo:    "octocat/hello-world",
+			match:   false,
+			matcher: Any([]string{"spaceghost/*"}, false),
+		},
+	}
+
+	for i, test := range tests {
+		repo := &drone.Repo{
+			Slug:    test.repo,
+			Trusted: test.trusted,
+		}
+		if got, want := test.matcher(repo, new(drone.Build)), test.match; got != want {
+			t.Errorf("Want match %v at index %d", want, i)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default is the default history.
+var Default = &History{Limit: 100}
+
+// Entry is the test report summary of a pipeline step.
+type Entry struct {
+	Repo    string
+	Build   int64
+	Stage   string
+	Step    string
+	Created time.Time
+	*Summary
+}
+
+// History stores the most recent test report summaries.
+type History struct {
+	// Limit is the maximum number of entries stored.
+	Limit int
+
+	mu      sync.Mutex
+	entries []*Entry
+}
+
+// Add adds an entry to the history. The oldest entry is
+// removed when the history exceeds the limit.
+func (h *History) Add(entry *Entry) {
+	h.mu.Lock()
+	h.entries = append(h.entries, entry)
+	if h.Limit > 0 && len(h.entries) > h.Limit {
+		h.entries = h.entries[len(h.entries)-h.Limit:]
+	}
+	h.mu.Unlock()
+}
+
+// Entries returns the entries, most recent first.
+func (h *History) Entries() []*Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := make([]*Entry, len(h.entries))
+	for i, entry := range h.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
+
+// ServeHTTP writes the test report summaries as an html page.
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page.Execute(w, h.Entries())
+}
+
+// Record adds the entry to the default history.
+func Record(entry *Entry) {
+	Default.Add(entry)
+}
+
+// Handler returns an http.Handler that serves the default
+// history.
+func Handler() http.Handler {
+	return Default
+}
+
+var page = template.Must(template.New("reports").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Test Reports</title>
+<link rel="stylesheet" type="text/css" href="/static/reset.css">
+<link rel="stylesheet" type="text/css" href="/static/style.css">
+</head>
+<body>
+<header class="navbar">
+<div class="logo"><a href="/">Dashboard</a></div>
+</header>
+<main>
+<section>
+<header><h1>Test Reports</h1></header>
+{{- if not . }}
+<p>No test reports.</p>
+{{- else }}
+<table>
+<thead>
+<tr><th>Repository</th><th>Build</th><th>Stage</th><th>Step</th><th>Passed</th><th>Failed</th><th>Skipped</th><th>Failures</th><th>Created</th></tr>
+</thead>
+<tbody>
+{{- range . }}
+<tr>
+<td>{{ .Repo }}</td>
+<td>{{ .Build }}</td>
+<td>{{ .Stage }}</td>
+<td>{{ .Step }}</td>
+<td>{{ .Passed }}</td>
+<td>{{ .Failed }}</td>
+<td>{{ .Skipped }}</td>
+<td>{{ range .Failures }}{{ . }}<br>{{ end }}</td>
+<td>{{ .Created.Format "2006-01-02 15:04:05" }}</td>
+</tr>
+{{- end }}
+</tbody>
+</table>
+{{- end }}
+</section>
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,120 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// junit test suite. The root element is either a testsuites
+// element or a testsuite element, and test suites may be
+// nested.
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+// junit test case.
+type junitCase struct {
+	Name      string    `xml:"name,attr"`
+	Classname string    `xml:"classname,attr"`
+	Failure   *struct{} `xml:"failure"`
+	Error     *struct{} `xml:"error"`
+	Skipped   *struct{} `xml:"skipped"`
+}
+
+// ParseJUnit parses the junit xml report and returns the
+// summary of the test results.
+func ParseJUnit(r io.Reader) (*Summary, error) {
+	suite := new(junitSuite)
+	if err := xml.NewDecoder(r).Decode(suite); err != nil {
+		return nil, err
+	}
+	summary := new(Summary)
+	summarize(summary, suite)
+	return summary, nil
+}
+
+// JUnit parses the junit xml reports in the directory that
+// match the glob pattern, and returns the combined summary of
+// the test results. Symbolic links are not followed, and a
+// report that is no longer a regular file when it is opened
+// is rejected.
+func JUnit(dir, pattern string) (*Summary, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	summary := new(Summary)
+	err := filepath.Walk(dir, func(source string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, source)
+		if err != nil {
+			return err
+		}
+		if ok, _ := doublestar.Match(pattern, filepath.ToSlash(rel)); !ok {
+			return nil
+		}
+		f, err := openNoFollow(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err != nil {
+			return err
+		} else if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", filepath.ToSlash(rel))
+		}
+		parsed, err := ParseJUnit(f)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s: %s", filepath.ToSlash(rel), err)
+		}
+		summary.Files++
+		summary.add(parsed)
+		return nil
+	})
+	return summary, err
+}
+
+// helper function adds the results of the test suite, and all
+// nested test suites, to the summary.
+func summarize(summary *Summary, suite *junitSuite) {
+	for i := range suite.Suites {
+		summarize(summary, &suite.Suites[i])
+	}
+	for _, c := range suite.Cases {
+		switch {
+		case c.Failure != nil, c.Error != nil:
+			summary.Failed++
+			summary.Failures = append(summary.Failures, testName(suite, &c))
+		case c.Skipped != nil:
+			summary.Skipped++
+		default:
+			summary.Passed++
+		}
+	}
+}
+
+// helper function returns the qualified test name.
+func testName(suite *junitSuite, c *junitCase) string {
+	switch {
+	case c.Classname != "":
+		return c.Classname + "." + c.Name
+	case suite.Name != "":
+		return suite.Name + "." + c.Name
+	default:
+		return c.Name
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package report
+
+import (
+	"fmt"
+	"os"
+)
+
+// helper function opens the named file for reading. Windows does
+// not support opening a file without following a symbolic link,
+// so the file is rejected if it is a symbolic link when opened.
+// The opened file is verified by the caller.
+func openNoFollow(name string) (*os.File, error) {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s is a symbolic link", name)
+	}
+	return os.Open(name)
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package report parses structured test reports produced by
+// the pipeline steps, and summarizes the test results.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// maximum number of failing tests written to the step logs.
+const maxFailures = 50
+
+// Summary summarizes the test results of a pipeline step.
+type Summary struct {
+	Files    int      `json:"files"`
+	Passed   int      `json:"passed"`
+	Failed   int      `json:"failed"`
+	Skipped  int      `json:"skipped"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Total returns the total number of tests.
+func (s *Summary) Total() int {
+	return s.Passed + s.Failed + s.Skipped
+}
+
+// add adds the test results to the summary.
+func (s *Summary) add(other *Summary) {
+	s.Passed += other.Passed
+	s.Failed += other.Failed
+	s.Skipped += other.Skipped
+	s.Failures = append(s.Failures, other.Failures...)
+}
+
+// Fprint writes the summary to the writer. The names of the
+// failing tests are truncated if there are too many failures.
+func Fprint(w io.Writer, s *Summary) {
+	fmt.Fprintf(w, "test results: %d passed, %d failed, %d skipped (%d files)\n",
+		s.Passed,
+		s.Failed,
+		s.Skipped,
+		s.Files,
+	)
+	for i, name := range s.Failures {
+		if i == maxFailures {
+			fmt.Fprintf(w, "... and %d more failed tests\n", len(s.Failures)-maxFailures)
+			break
+		}
+		fmt.Fprintf(w, "FAIL: %s\n", name)
+	}
+}
+
+// Write writes the summary to the named file in json format.
+// The file is readable by all users, so that the summary can
+// be read by subsequent pipeline steps.
+func Write(path string, s *Summary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testsuites = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="math" tests="4">
+    <testcase classname="math" name="TestAdd"></testcase>
+    <testcase classname="math" name="TestSub">
+      <failure message="expected 1, got 2">math_test.go:12</failure>
+    </testcase>
+    <testcase classname="math" name="TestDiv">
+      <skipped message="not implemented"/>
+    </testcase>
+    <testsuite name="nested">
+      <testcase name="TestPanic">
+        <error message="panic"/>
+      </testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>
+`
+
+const testsuite = `<testsuite name="strings">
+  <testcase name="TestUpper"/>
+  <testcase name="TestLower"/>
+</testsuite>
+`
+
+func TestParseJUnit(t *testing.T) {
+	got, err := ParseJUnit(strings.NewReader(testsuites))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := &Summary{
+		Passed:   1,
+		Failed:   2,
+		Skipped:  1,
+		Failures: []string{"nested.TestPanic", "math.TestSub"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected summary")
+		t.Log(diff)
+	}
+}
+
+func TestParseJUnit_Malformed(t *testing.T) {
+	_, err := ParseJUnit(strings.NewReader("<testsuite>"))
+	if err == nil {
+		t.Errorf("Expect error when malformed xml")
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(dir, "math", "target"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "math", "target", "TEST-math.xml"), []byte(testsuites), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "TEST-strings.xml"), []byte(testsuite), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "other.xml"), []byte("<malformed"), 0600)
+
+	got, err := JUnit(dir, "**/TEST-*.xml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := &Summary{
+		Files:    2,
+		Passed:   3,
+		Failed:   2,
+		Skipped:  1,
+		Failures: []string{"nested.TestPanic", "math.TestSub"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected summary")
+		t.Log(diff)
+	}
+
+	_, err = JUnit(dir, "*.xml")
+	if err == nil {
+		t.Errorf("Expect error when report is malformed")
+	}
+}
+
+func TestFprint(t *testing.T) {
+	summary := &Summary{Files: 1, Passed: 3, Failed: 1, Failures: []string{"math.TestSub"}}
+	var buf bytes.Buffer
+	Fprint(&buf, summary)
+	want := "test results: 3 passed, 1 failed, 0 skipped (1 files)\nFAIL: math.TestSub\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want summary %q, got %q", want, got)
+	}
+
+	summary = &Summary{}
+	for i := 0; i < maxFailures+2; i++ {
+		summary.Failures = append(summary.Failures, fmt.Sprintf("Test%d", i))
+	}
+	buf.Reset()
+	Fprint(&buf, summary)
+	if !strings.HasSuffix(buf.String(), "... and 2 more failed tests\n") {
+		t.Errorf("Want failed tests truncated, got %q", buf.String())
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "reports", "test.json")
+	want := &Summary{Files: 1, Passed: 2, Failed: 1, Failures: []string{"math.TestSub"}}
+	if err := Write(path, want); err != nil {
+		t.Error(err)
+		return
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got := new(Summary)
+	json.Unmarshal(raw, got)
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected summary file")
+		t.Log(diff)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := &History{Limit: 2}
+	h.Add(&Entry{Step: "a", Summary: &Summary{}})
+	h.Add(&Entry{Step: "b", Summary: &Summary{}})
+	h.Add(&Entry{Step: "c", Summary: &Summary{Failures: []string{"<script>"}}})
+
+	entries := h.Entries()
+	if got, want := len(entries), 2; got != want {
+		t.Errorf("Want %d entries, got %d", want, got)
+		return
+	}
+	if entries[0].Step != "c" || entries[1].Step != "b" {
+		t.Errorf("Want most recent entries first")
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/reports", nil))
+	if body := w.Body.String(); strings.Contains(body, "<script>") {
+		t.Errorf("Want failed test names escaped")
+	}
+}
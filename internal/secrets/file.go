@@ -0,0 +1,175 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/secret"
+)
+
+// errKeySize is returned when the encryption key is not 32
+// bytes.
+var errKeySize = errors.New("secrets: encryption key must be 32 bytes")
+
+// Dir returns a provider that finds secrets in a directory on
+// the host machine. Each secret is stored in a file named after
+// the secret. A single trailing newline is removed from the
+// secret value.
+func Dir(path string) secret.Provider {
+	return &dir{path: path}
+}
+
+type dir struct {
+	path string
+}
+
+func (p *dir) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	logger := logger.FromContext(ctx).
+		WithField("name", in.Name).
+		WithField("kind", "secret")
+
+	// the secret name must be a single path element, so that
+	// files outside of the directory cannot be read.
+	name := in.Name
+	if name == "" || name == "." || name == ".." ||
+		strings.ContainsAny(name, `/\`) {
+		logger.Trace("secret: dir: invalid secret name")
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(p.path, name))
+	if os.IsNotExist(err) {
+		logger.Trace("secret: dir: no matching secret")
+		return nil, nil
+	}
+	if err != nil {
+		logger.WithError(err).Debug("secret: dir: cannot read secret")
+		return nil, err
+	}
+
+	logger.Trace("secret: dir: found matching secret")
+	return &drone.Secret{
+		Name: name,
+		Data: strings.TrimSuffix(string(data), "\n"),
+	}, nil
+}
+
+// File returns a provider that finds secrets in an encrypted
+// file on the host machine. The file is created with Encrypt,
+// and is read each time a secret is requested, so that the file
+// can be updated without restarting the runner.
+func File(path, key string) (secret.Provider, error) {
+	if len(key) != 32 {
+		return nil, errKeySize
+	}
+	return &file{path: path, key: []byte(key)}, nil
+}
+
+type file struct {
+	path string
+	key  []byte
+}
+
+func (p *file) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	logger := logger.FromContext(ctx).
+		WithField("name", in.Name).
+		WithField("kind", "secret")
+
+	raw, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		logger.WithError(err).Debug("secret: file: cannot read file")
+		return nil, err
+	}
+	secrets, err := decrypt(raw, p.key)
+	if err != nil {
+		logger.WithError(err).Debug("secret: file: cannot decrypt file")
+		return nil, err
+	}
+	data, ok := secrets[in.Name]
+	if !ok {
+		logger.Trace("secret: file: no matching secret")
+		return nil, nil
+	}
+
+	logger.Trace("secret: file: found matching secret")
+	return &drone.Secret{
+		Name: in.Name,
+		Data: data,
+	}, nil
+}
+
+// Encrypt encrypts the named secrets with the 32 byte key, and
+// returns the base64 encoded file contents. The secrets are
+// encrypted with AES-256 in GCM mode.
+func Encrypt(secrets map[string]string, key string) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, errKeySize
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// helper function decodes and decrypts the file contents, and
+// returns the named secrets.
+func decrypt(raw, key []byte) (map[string]string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(raw)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("secrets: malformed ciphertext")
+	}
+	plaintext, err := gcm.Open(nil,
+		ciphertext[:gcm.NonceSize()],
+		ciphertext[gcm.NonceSize():],
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	secrets := map[string]string{}
+	err = json.Unmarshal(plaintext, &secrets)
+	return secrets, err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package secrets provides built-in secret providers, for hosts
+// without a secret plugin.
+package secrets
+
+import (
+	"context"
+
+	"github.com/drone-runners/drone-runner-exec/internal/match"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/manifest"
+	"github.com/drone/runner-go/secret"
+)
+
+// Scope returns a provider that finds secrets in the provider
+// only if the repository name matches one of the glob patterns.
+// All repositories match if no patterns are defined. Secrets
+// are never exposed to pull requests from forks of public
+// repositories.
+func Scope(provider secret.Provider, repos []string) secret.Provider {
+	return &scoped{
+		provider: provider,
+		match:    match.Func(repos, nil, false),
+	}
+}
+
+type scoped struct {
+	provider secret.Provider
+	match    func(*drone.Repo, *drone.Build) bool
+}
+
+func (p *scoped) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	logger := logger.FromContext(ctx).
+		WithField("name", in.Name).
+		WithField("kind", "secret")
+
+	if p.match(in.Repo, in.Build) == false {
+		logger.Trace("secret: scope: repository does not match")
+		return nil, nil
+	}
+	if in.Repo.Private == false &&
+		in.Build.Event == drone.EventPullRequest &&
+		in.Build.Fork != "" {
+		logger.Trace("secret: scope: restricted from forks")
+		return nil, nil
+	}
+	return p.provider.Find(ctx, in)
+}
+
+// helper function returns the path and name of the named secret
+// resource defined in the configuration file.
+func lookup(spec *manifest.Manifest, name string) (path, key string, ok bool) {
+	if spec == nil {
+		return
+	}
+	for _, resource := range spec.Resources {
+		secret, ok := resource.(*manifest.Secret)
+		if !ok {
+			continue
+		}
+		if secret.Name != name {
+			continue
+		}
+		if secret.Get.Path == "" || secret.Get.Name == "" {
+			continue
+		}
+		return secret.Get.Path, secret.Get.Name, true
+	}
+	return
+}
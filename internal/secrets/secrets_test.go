@@ -0,0 +1,134 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/secret"
+)
+
+var noContext = context.Background()
+
+func TestScope(t *testing.T) {
+	provider := Scope(
+		secret.Static([]*drone.Secret{
+			{Name: "password", Data: "correct-horse-battery-staple", PullRequest: true},
+		}),
+		[]string{"octocat/*"},
+	)
+	tests := []struct {
+		repo  *drone.Repo
+		build *drone.Build
+		found bool
+	}{
+		{
+			repo:  &drone.Repo{Slug: "octocat/hello-world"},
+			build: &drone.Build{Event: drone.EventPush},
+			found: true,
+		},
+		{
+			repo:  &drone.Repo{Slug: "spaceghost/hello-world"},
+			build: &drone.Build{Event: drone.EventPush},
+			found: false,
+		},
+		// pull requests from forks of public repositories
+		{
+			repo:  &drone.Repo{Slug: "octocat/hello-world"},
+			build: &drone.Build{Event: drone.EventPullRequest, Fork: "spaceghost/hello-world"},
+			found: false,
+		},
+		{
+			repo:  &drone.Repo{Slug: "octocat/hello-world", Private: true},
+			build: &drone.Build{Event: drone.EventPullRequest, Fork: "spaceghost/hello-world"},
+			found: true,
+		},
+	}
+	for i, test := range tests {
+		found, err := provider.Find(noContext, &secret.Request{
+			Name:  "password",
+			Repo:  test.repo,
+			Build: test.build,
+		})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, want := found != nil, test.found; got != want {
+			t.Errorf("Want secret found %v for test %d, got %v", want, i, got)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "secrets")
+	os.Mkdir(dir, 0700)
+	ioutil.WriteFile(filepath.Join(dir, "password"), []byte("correct-horse-battery-staple\n"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "outside"), []byte("outside"), 0600)
+
+	provider := Dir(dir)
+	found, err := provider.Find(noContext, &secret.Request{Name: "password"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found == nil || found.Data != "correct-horse-battery-staple" {
+		t.Errorf("Want secret found without trailing newline, got %v", found)
+	}
+
+	for _, name := range []string{"username", "../outside", "..", ""} {
+		found, err := provider.Find(noContext, &secret.Request{Name: name})
+		if err != nil {
+			t.Error(err)
+		}
+		if found != nil {
+			t.Errorf("Want secret %q not found", name)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+	data, err := Encrypt(map[string]string{"password": "correct-horse-battery-staple"}, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	ioutil.WriteFile(path, data, 0600)
+
+	provider, err := File(path, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	found, err := provider.Find(noContext, &secret.Request{Name: "password"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found == nil || found.Data != "correct-horse-battery-staple" {
+		t.Errorf("Want secret decrypted, got %v", found)
+	}
+	found, err = provider.Find(noContext, &secret.Request{Name: "username"})
+	if err != nil || found != nil {
+		t.Errorf("Want secret not found, got %v, %v", found, err)
+	}
+
+	// the file cannot be decrypted with a different key.
+	provider, _ = File(path, "fedcba9876543210fedcba9876543210")
+	if _, err := provider.Find(noContext, &secret.Request{Name: "password"}); err == nil {
+		t.Errorf("Want error decrypting with the wrong key")
+	}
+	if _, err := File(path, "short"); err == nil {
+		t.Errorf("Want error for invalid key size")
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/secret"
+)
+
+// errForbidden is returned when the vault token is rejected.
+var errForbidden = errors.New("secrets: vault: permission denied")
+
+// errInvalidPath is returned when the secret path contains a
+// relative path segment.
+var errInvalidPath = errors.New("secrets: vault: invalid secret path")
+
+// VaultConfig configures a HashiCorp Vault secret provider.
+type VaultConfig struct {
+	// Address is the vault server url.
+	Address string
+
+	// Mount is the path of the KV version 2 secrets engine.
+	// Defaults to secret.
+	Mount string
+
+	// Token is the token used to authenticate requests.
+	Token string
+
+	// RoleID and SecretID are the AppRole credentials used to
+	// authenticate requests, if the token is empty. The token
+	// returned by the login is renewed once half of the lease
+	// duration has passed.
+	RoleID   string
+	SecretID string
+
+	// SkipVerify disables verification of the server
+	// certificate.
+	SkipVerify bool
+}
+
+// Vault returns a provider that finds secrets in the KV version
+// 2 secrets engine of a HashiCorp Vault server. The secret is
+// defined in the configuration file as a secret resource, where
+// the path is relative to the secrets engine mount, and the name
+// is the key of the secret value.
+func Vault(config VaultConfig) secret.Provider {
+	if config.Mount == "" {
+		config.Mount = "secret"
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	config.Mount = strings.Trim(config.Mount, "/")
+
+	client := http.DefaultClient
+	if config.SkipVerify {
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			},
+		}
+	}
+	return &vault{config: config, client: client}
+}
+
+type vault struct {
+	config VaultConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (p *vault) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	logger := logger.FromContext(ctx).
+		WithField("name", in.Name).
+		WithField("kind", "secret")
+
+	path, key, ok := lookup(in.Conf, in.Name)
+	if !ok {
+		logger.Trace("secret: vault: no matching secret")
+		return nil, nil
+	}
+
+	// include a timeout to prevent an API call from hanging
+	// the build process indefinitely.
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	data, err := p.read(ctx, path)
+	if err == errForbidden && p.config.Token == "" {
+		// the AppRole token may be revoked before the lease
+		// expires, in which case the runner logs in again.
+		p.reset()
+		data, err = p.read(ctx, path)
+	}
+	if err != nil {
+		logger.WithError(err).Debug("secret: vault: cannot get secret")
+		return nil, err
+	}
+
+	value, ok := data[key]
+	if !ok || value == nil {
+		logger.Trace("secret: vault: no matching secret")
+		return nil, nil
+	}
+
+	logger.Trace("secret: vault: found matching secret")
+	s, ok := value.(string)
+	if !ok {
+		raw, _ := json.Marshal(value)
+		s = string(raw)
+	}
+	return &drone.Secret{
+		Name: in.Name,
+		Data: s,
+	}, nil
+}
+
+// helper function reads the latest version of the secret at the
+// named path. A nil map is returned if the secret does not
+// exist.
+func (p *vault) read(ctx context.Context, path string) (map[string]interface{}, error) {
+	// the path is defined in the configuration file, and must
+	// not escape the secrets engine mount. Each segment is
+	// escaped, so that special characters, such as a question
+	// mark, are not interpreted as part of the url.
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, errInvalidPath
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+
+	token, err := p.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s",
+		p.config.Address,
+		p.config.Mount,
+		strings.Join(segments, "/"),
+	)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	out := struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := p.do(req, &out); err != nil {
+		return nil, err
+	}
+	return out.Data.Data, nil
+}
+
+// helper function returns the token used to authenticate
+// requests, logging in with the AppRole credentials if the
+// token is not configured.
+func (p *vault) login(ctx context.Context) (string, error) {
+	if p.config.Token != "" {
+		return p.config.Token, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && (p.expires.IsZero() || time.Now().Before(p.expires)) {
+		return p.token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"role_id":   p.config.RoleID,
+		"secret_id": p.config.SecretID,
+	})
+	endpoint := p.config.Address + "/v1/auth/approle/login"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	out := struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}{}
+	if err := p.do(req, &out); err != nil {
+		return "", err
+	}
+	if out.Auth.ClientToken == "" {
+		return "", errors.New("secrets: vault: login returned no token")
+	}
+
+	p.token = out.Auth.ClientToken
+	p.expires = time.Time{}
+	if lease := out.Auth.LeaseDuration; lease > 0 {
+		p.expires = time.Now().Add(time.Duration(lease) * time.Second / 2)
+	}
+	return p.token, nil
+}
+
+// helper function discards the AppRole token.
+func (p *vault) reset() {
+	p.mu.Lock()
+	p.token = ""
+	p.mu.Unlock()
+}
+
+// helper function sends the request and decodes the json
+// response body. A not found response is not an error, and
+// leaves the output unchanged.
+func (p *vault) do(req *http.Request, out interface{}) error {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil
+	case res.StatusCode == http.StatusForbidden:
+		return errForbidden
+	case res.StatusCode > 299:
+		return fmt.Errorf("secrets: vault: unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
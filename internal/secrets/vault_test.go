@@ -0,0 +1,163 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/drone/runner-go/manifest"
+	"github.com/drone/runner-go/secret"
+)
+
+// helper function returns a stub vault server with a single
+// secret, that accepts the token, or the token returned by the
+// AppRole login.
+func testVault(t *testing.T, logins *int32) *httptest.Server {
+	var token atomic.Value
+	token.Store("s.root")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		in := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&in)
+		if r.Method != "POST" || in["role_id"] != "drone" || in["secret_id"] != "s3cr3t" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(logins, 1)
+		token.Store("s.approle")
+		w.Write([]byte(`{"auth":{"client_token":"s.approle","lease_duration":3600}}`))
+	})
+	mux.HandleFunc("/v1/kv/data/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token.Load().(string) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/ci/docker" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"correct-horse-battery-staple","port":5000},"metadata":{"version":2}}}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// helper function returns a secret request for the named secret
+// resource.
+func testRequest(name, path, key string) *secret.Request {
+	return &secret.Request{
+		Name: name,
+		Conf: &manifest.Manifest{
+			Resources: []manifest.Resource{
+				&manifest.Secret{
+					Kind: "secret",
+					Name: name,
+					Get:  manifest.SecretGet{Path: path, Name: key},
+				},
+			},
+		},
+	}
+}
+
+func TestVault_Token(t *testing.T) {
+	var logins int32
+	server := testVault(t, &logins)
+	provider := Vault(VaultConfig{
+		Address: server.URL + "/",
+		Mount:   "kv",
+		Token:   "s.root",
+	})
+
+	found, err := provider.Find(noContext, testRequest("docker_password", "ci/docker", "password"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found == nil || found.Data != "correct-horse-battery-staple" {
+		t.Errorf("Want secret found, got %v", found)
+	}
+
+	found, err = provider.Find(noContext, testRequest("docker_port", "ci/docker", "port"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found == nil || found.Data != "5000" {
+		t.Errorf("Want non-string secret encoded as json, got %v", found)
+	}
+
+	for _, req := range []*secret.Request{
+		testRequest("docker_username", "ci/docker", "username"),
+		testRequest("npm_token", "ci/npm", "token"),
+		{Name: "undefined", Conf: &manifest.Manifest{}},
+	} {
+		found, err := provider.Find(noContext, req)
+		if err != nil {
+			t.Error(err)
+		}
+		if found != nil {
+			t.Errorf("Want secret %s not found", req.Name)
+		}
+	}
+	if logins != 0 {
+		t.Errorf("Want no approle login when the token is configured")
+	}
+
+	for _, path := range []string{"../sys/policy", "ci/../../sys", "ci/./docker", "ci//docker"} {
+		if _, err := provider.Find(noContext, testRequest("docker_password", path, "password")); err != errInvalidPath {
+			t.Errorf("Want error for path %q, got %v", path, err)
+		}
+	}
+
+	provider = Vault(VaultConfig{Address: server.URL, Mount: "kv", Token: "s.invalid"})
+	if _, err := provider.Find(noContext, testRequest("docker_password", "ci/docker", "password")); err == nil {
+		t.Errorf("Want error when the token is rejected")
+	}
+}
+
+func TestVault_AppRole(t *testing.T) {
+	var logins int32
+	server := testVault(t, &logins)
+	provider := Vault(VaultConfig{
+		Address:  server.URL,
+		Mount:    "kv",
+		RoleID:   "drone",
+		SecretID: "s3cr3t",
+	})
+
+	for i := 0; i < 2; i++ {
+		found, err := provider.Find(noContext, testRequest("docker_password", "ci/docker", "password"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if found == nil || found.Data != "correct-horse-battery-staple" {
+			t.Errorf("Want secret found, got %v", found)
+		}
+	}
+	if got, want := atomic.LoadInt32(&logins), int32(1); got != want {
+		t.Errorf("Want token reused until the lease expires, got %d logins", got)
+	}
+
+	// the runner logs in again if the token is revoked.
+	provider.(*vault).token = "s.revoked"
+	if _, err := provider.Find(noContext, testRequest("docker_password", "ci/docker", "password")); err != nil {
+		t.Error(err)
+	}
+	if got, want := atomic.LoadInt32(&logins), int32(2); got != want {
+		t.Errorf("Want login after the token is revoked, got %d logins", got)
+	}
+
+	provider = Vault(VaultConfig{Address: server.URL, Mount: "kv", RoleID: "drone", SecretID: "invalid"})
+	if _, err := provider.Find(noContext, testRequest("docker_password", "ci/docker", "password")); err == nil {
+		t.Errorf("Want error when the approle login fails")
+	}
+}
@@ -6,9 +6,11 @@ package main
 
 import (
 	"github.com/drone-runners/drone-runner-exec/command"
+	"github.com/drone-runners/drone-runner-exec/engine"
 	_ "github.com/joho/godotenv/autoload"
 )
 
 func main() {
+	engine.InitSandbox()
 	command.Command()
 }
@@ -8,10 +8,19 @@ package runtime
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/replacer"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
+	"github.com/drone-runners/drone-runner-exec/internal/cache"
+	"github.com/drone-runners/drone-runner-exec/internal/janitor"
+	"github.com/drone-runners/drone-runner-exec/internal/report"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/logger"
@@ -22,6 +31,10 @@ import (
 	"golang.org/x/sync/semaphore"
 )
 
+// errNoStore is returned if the pipeline defines artifacts and
+// the artifact store is not configured.
+var errNoStore = errors.New("artifact store is not configured")
+
 // Execer is the execution context for executing the intermediate
 // representation of a pipeline.
 type Execer interface {
@@ -34,6 +47,8 @@ type execer struct {
 	reporter pipeline.Reporter
 	streamer pipeline.Streamer
 	sem      *semaphore.Weighted
+	keep     Keep
+	store    artifact.Store
 }
 
 // NewExecer returns a new execer used
@@ -42,11 +57,15 @@ func NewExecer(
 	streamer pipeline.Streamer,
 	engine engine.Engine,
 	procs int64,
+	keep Keep,
+	store artifact.Store,
 ) Execer {
 	exec := &execer{
 		reporter: reporter,
 		streamer: streamer,
 		engine:   engine,
+		keep:     keep,
+		store:    store,
 	}
 	if procs > 0 {
 		// optional semaphor that limits the number of steps
@@ -59,20 +78,39 @@ func NewExecer(
 // Exec executes the intermediate representation of the pipeline
 // and returns an error if execution fails.
 func (e *execer) Exec(ctx context.Context, spec *engine.Spec, state *pipeline.State) error {
-	defer e.engine.Destroy(noContext, spec)
+	defer e.destroy(ctx, spec, state)
 
 	if err := e.engine.Setup(noContext, spec); err != nil {
 		state.FailAll(err)
 		return e.reporter.ReportStage(noContext, state)
 	}
 
+	// detached steps run until all other pipeline steps are
+	// complete, at which point they are terminated.
+	services := newDetached(ctx)
+
+	// the workspace cache is restored after the clone step,
+	// since the cache key may depend on repository files. If
+	// the clone step is disabled the cache is restored before
+	// the pipeline steps execute.
+	if spec.Cache != nil && !hasStep(spec, "clone") {
+		e.restore(ctx, spec)
+	}
+
 	// create a directed graph, where each vertex in the graph
 	// is a pipeline step.
 	var d dag.Runner
 	for _, s := range spec.Steps {
 		step := s
 		d.AddVertex(step.Name, func() error {
-			return e.exec(ctx, state, spec, step)
+			err := e.exec(ctx, state, spec, step, services)
+			// the cache is not restored if the clone step
+			// fails, since the workspace is incomplete and the
+			// pipeline steps do not execute.
+			if spec.Cache != nil && step.Name == "clone" && err == nil && passed(state, step.Name) {
+				e.restore(ctx, spec)
+			}
+			return err
 		})
 	}
 
@@ -86,19 +124,29 @@ func (e *execer) Exec(ctx context.Context, spec *engine.Spec, state *pipeline.St
 
 	var result error
 	if err := d.Run(); err != nil {
-		multierror.Append(result, err)
+		result = multierror.Append(result, err)
+	}
+
+	// terminate the detached steps and wait for their log
+	// streams to be closed before the stage is reported.
+	services.stop()
+
+	// the workspace cache is saved only if the pipeline
+	// completes successfully.
+	if spec.Cache != nil && ctx.Err() == nil && !state.Failed() {
+		e.save(ctx, spec)
 	}
 
 	// once pipeline execution completes, notify the state
 	// manageer that all steps are finished.
 	state.FinishAll()
 	if err := e.reporter.ReportStage(noContext, state); err != nil {
-		multierror.Append(result, err)
+		result = multierror.Append(result, err)
 	}
 	return result
 }
 
-func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step) error {
+func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, services *detached) error {
 	var result error
 
 	select {
@@ -116,9 +164,11 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 		// the semaphore limits the number of steps that can run
 		// concurrently. acquire the semaphore and release when
 		// the pipeline completes.
+		waited := time.Now()
 		if err := e.sem.Acquire(ctx, 1); err != nil {
 			return nil
 		}
+		semaphoreWait.Observe(time.Since(waited).Seconds())
 
 		defer func() {
 			// recover from a panic to ensure the semaphore is
@@ -172,18 +222,27 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 	wc := e.streamer.Stream(noContext, state, step.Name)
 	wc = replacer.New(wc, step.Secrets)
 
+	// the artifacts step uploads the build outputs to the
+	// artifact store instead of executing a command.
+	if step.Artifacts != nil {
+		return e.upload(ctx, state, copy, wc, services)
+	}
+
 	// if the step is configured as a daemon, it is detached
 	// from the main process and executed separately.
-	// todo(bradrydzewski) this code is still experimental.
 	if step.Detach {
-		go func() {
-			e.engine.Run(ctx, spec, copy, wc)
-			wc.Close()
-		}()
-		return nil
+		return e.detach(ctx, state, spec, copy, wc, services)
 	}
 
-	exited, err := e.engine.Run(ctx, spec, copy, wc)
+	defer observeStep(state, step.Name, time.Now())
+
+	exited, err := e.run(ctx, spec, copy, wc)
+
+	// the test reports are parsed once the step exits, and the
+	// summary is written to the end of the step logs.
+	if exited != nil && step.Reports != nil {
+		e.report(ctx, state, step, wc)
+	}
 
 	// close the stream. If the session is a remote session, the
 	// full log buffer is uploaded to the remote server.
@@ -193,6 +252,13 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 
 	if exited != nil {
 		state.Finish(step.Name, exited.ExitCode)
+		// if the step was killed by the kernel out of memory
+		// killer, the reason is surfaced in the step error.
+		if exited.OOMKilled {
+			state.Lock()
+			findStep(state, step.Name).Error = "step killed, out of memory"
+			state.Unlock()
+		}
 		err := e.reporter.ReportStep(noContext, state, step.Name)
 		if err != nil {
 			multierror.Append(result, err)
@@ -212,7 +278,8 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 	}
 
 	// if the step failed with an internal error (as oppsed to a
-	// runtime error) the step is failed.
+	// runtime error) the step is failed. a step that exceeds its
+	// timeout is also failed, without cancelling the stage.
 	state.Fail(step.Name, err)
 	err = e.reporter.ReportStep(noContext, state, step.Name)
 	if err != nil {
@@ -221,6 +288,236 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 	return result
 }
 
+// run executes the step, and executes the step again if it
+// fails and the retry policy allows. A separator is written to
+// the step logs between attempts, and the result of the final
+// attempt is returned.
+func (e *execer) run(ctx context.Context, spec *engine.Spec, step *engine.Step, w io.Writer) (*engine.State, error) {
+	exited, err := e.engine.Run(ctx, spec, step, w)
+	if step.Retry == nil {
+		return exited, err
+	}
+
+	delay := step.Retry.Delay
+	for attempt := 2; attempt <= step.Retry.Attempts; attempt++ {
+		if ctx.Err() != nil || !WillRetry(step, attempt-1, exited, err) {
+			break
+		}
+		reason := fmt.Sprint(err)
+		if exited != nil {
+			reason = fmt.Sprintf("exit code %d", exited.ExitCode)
+		}
+		fmt.Fprintf(w, "--- attempt %d of %d failed (%s), retrying in %s ---\n",
+			attempt-1,
+			step.Retry.Attempts,
+			reason,
+			delay,
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if step.Retry.Backoff > 0 {
+			delay = time.Duration(float64(delay) * step.Retry.Backoff)
+		}
+
+		stepRetries.Inc()
+		exited, err = e.engine.Run(ctx, spec, step, w)
+	}
+	return exited, err
+}
+
+// detach executes the detached step in a separate go routine
+// and blocks until the step satisfies its readiness conditions,
+// if configured.
+func (e *execer) detach(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, wc io.WriteCloser, services *detached) error {
+	log := logger.FromContext(ctx)
+	exited := make(chan struct{})
+
+	services.Add(1)
+	go func() {
+		defer services.Done()
+		defer close(exited)
+
+		ctx := logger.WithContext(services.ctx, log)
+		result, err := e.engine.Run(ctx, spec, step, wc)
+		if err := wc.Close(); err != nil {
+			log.WithError(err).Debug("cannot close detached step stream")
+		}
+
+		// the detached step is expected to be terminated when
+		// the pipeline completes. The step state is only updated
+		// if the step exits on its own.
+		if services.ctx.Err() != nil {
+			return
+		}
+		if result != nil {
+			state.Finish(step.Name, result.ExitCode)
+		} else if err != nil {
+			state.Fail(step.Name, err)
+		}
+		e.reporter.ReportStep(noContext, state, step.Name)
+	}()
+
+	if step.Ready == nil {
+		return nil
+	}
+
+	err := waitReady(ctx, step, exited)
+	switch err {
+	case nil:
+		log.Debug("detached step is ready")
+		return nil
+	case context.Canceled, context.DeadlineExceeded:
+		state.Cancel()
+		return nil
+	}
+
+	state.Fail(step.Name, err)
+	return e.reporter.ReportStep(noContext, state, step.Name)
+}
+
+// helper function destroys the pipeline workspace, unless the
+// workspace is kept for debugging. A kept workspace is recorded
+// in the workspace manifest so that it is eventually removed.
+func (e *execer) destroy(ctx context.Context, spec *engine.Spec, state *pipeline.State) {
+	switch {
+	case e.keep == KeepAlways:
+	case e.keep == KeepOnFailure && state.Failed():
+	default:
+		e.engine.Destroy(noContext, spec)
+		return
+	}
+
+	state.Lock()
+	entry := &janitor.Entry{
+		Path:    spec.Root,
+		Repo:    state.Repo.Slug,
+		Build:   state.Build.Number,
+		Stage:   state.Stage.Name,
+		Status:  state.Stage.Status,
+		Created: time.Now().Unix(),
+	}
+	state.Unlock()
+
+	log := logger.FromContext(ctx).
+		WithField("path", spec.Root)
+	if err := janitor.Record(filepath.Dir(spec.Root), entry); err != nil {
+		log.WithError(err).Warn("cannot record the kept workspace")
+	}
+	log.Info("kept the pipeline workspace")
+}
+
+// upload uploads the build outputs to the artifact store. The
+// manifest of uploaded files is written to the step logs. The
+// detached steps are terminated before the upload, so that the
+// build outputs cannot change while they are uploaded.
+func (e *execer) upload(ctx context.Context, state *pipeline.State, step *engine.Step, wc io.WriteCloser, services *detached) error {
+	services.stop()
+
+	err := errNoStore
+	if e.store != nil {
+		err = artifact.Upload(ctx, e.store, step.Artifacts, wc)
+	}
+	if err != nil {
+		fmt.Fprintln(wc, err)
+	}
+	if err := wc.Close(); err != nil {
+		logger.FromContext(ctx).WithError(err).Debug("cannot close artifacts stream")
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		state.Cancel()
+		return nil
+	case err != nil:
+		state.Fail(step.Name, err)
+	default:
+		state.Finish(step.Name, 0)
+	}
+	return e.reporter.ReportStep(noContext, state, step.Name)
+}
+
+// report parses the structured test reports produced by the
+// step and writes the summary of the test results to the step
+// logs and to the summary file. A failure to parse the test
+// reports does not fail the step. The summary file is owned by
+// the runner process, and is written to the protected reports
+// directory, which the pipeline steps cannot modify.
+func (e *execer) report(ctx context.Context, state *pipeline.State, step *engine.Step, w io.Writer) {
+	log := logger.FromContext(ctx)
+	summary, err := report.JUnit(step.Reports.Dir, step.Reports.JUnit)
+	if err != nil {
+		fmt.Fprintf(w, "cannot parse test reports: %s\n", err)
+		log.WithError(err).Warn("cannot parse the test reports")
+		return
+	}
+	report.Fprint(w, summary)
+
+	if err := report.Write(step.Reports.Path, summary); err != nil {
+		log.WithError(err).Warn("cannot write the test report summary")
+	}
+
+	state.Lock()
+	report.Record(&report.Entry{
+		Repo:    state.Repo.Slug,
+		Build:   state.Build.Number,
+		Stage:   state.Stage.Name,
+		Step:    step.Name,
+		Created: time.Now(),
+		Summary: summary,
+	})
+	state.Unlock()
+}
+
+// helper function restores the workspace cache. A failure to
+// restore the cache does not fail the pipeline.
+func (e *execer) restore(ctx context.Context, spec *engine.Spec) {
+	log := logger.FromContext(ctx).
+		WithField("cache.key", cache.Key(spec.Cache))
+	if err := cache.Restore(spec); err != nil {
+		log.WithError(err).Warn("cannot restore the workspace cache")
+		return
+	}
+	log.Debug("restored the workspace cache")
+}
+
+// helper function saves the workspace cache. A failure to save
+// the cache does not fail the pipeline.
+func (e *execer) save(ctx context.Context, spec *engine.Spec) {
+	log := logger.FromContext(ctx).
+		WithField("cache.key", cache.Key(spec.Cache))
+	if err := cache.Save(spec); err != nil {
+		log.WithError(err).Warn("cannot save the workspace cache")
+		return
+	}
+	log.Debug("saved the workspace cache")
+}
+
+// detached tracks the detached steps of a running stage.
+type detached struct {
+	sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// helper function returns a new detached step tracker. The
+// detached steps are terminated when the parent context is
+// cancelled, or when the tracker is stopped.
+func newDetached(ctx context.Context) *detached {
+	ctx, cancel := context.WithCancel(ctx)
+	return &detached{ctx: ctx, cancel: cancel}
+}
+
+// stop terminates the detached steps and blocks until the
+// steps exit.
+func (d *detached) stop() {
+	d.cancel()
+	d.Wait()
+}
+
 // helper function to clone a step. The runner mutates a step to
 // update the environment variables to reflect the current
 // pipeline state.
@@ -231,6 +528,58 @@ func cloneStep(src *engine.Step) *engine.Step {
 	return dst
 }
 
+// WillRetry returns true if the step is executed again by the
+// retry policy after the numbered attempt, starting at one,
+// exits with the result.
+func WillRetry(step *engine.Step, attempt int, exited *engine.State, err error) bool {
+	if step.Retry == nil || attempt >= step.Retry.Attempts {
+		return false
+	}
+	return shouldRetry(step.Retry, exited, err)
+}
+
+// helper function returns true if the step result satisfies
+// the retry policy. A step that exits with code 78, which skips
+// the remaining pipeline steps, is never retried. A step that
+// exceeds its timeout is retried unless the retry policy is
+// limited to specific exit codes.
+func shouldRetry(retry *engine.Retry, exited *engine.State, err error) bool {
+	if exited == nil {
+		return err == engine.ErrTimeout && len(retry.ExitCodes) == 0
+	}
+	if exited.ExitCode == 0 || exited.ExitCode == 78 {
+		return false
+	}
+	if len(retry.ExitCodes) == 0 {
+		return true
+	}
+	for _, code := range retry.ExitCodes {
+		if code == exited.ExitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the named step exists in
+// the pipeline spec.
+func hasStep(spec *engine.Spec, name string) bool {
+	for _, step := range spec.Steps {
+		if step.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the named step completed
+// successfully.
+func passed(state *pipeline.State, name string) bool {
+	state.Lock()
+	defer state.Unlock()
+	return findStep(state, name).Status == drone.StatusPassing
+}
+
 // helper function returns the named step from the state.
 func findStep(state *pipeline.State, name string) *drone.Step {
 	for _, step := range state.Stage.Steps {
@@ -7,7 +7,14 @@
 package runtime
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
 )
 
 func TestExec(t *testing.T) {
@@ -37,3 +44,103 @@ func TestExec_ReportError(t *testing.T) {
 func TestExec_SkipCtxDone(t *testing.T) {
 	t.Skip()
 }
+
+func TestExec_Retry(t *testing.T) {
+	tests := []struct {
+		retry *engine.Retry
+		codes []int
+		runs  int
+		exit  int
+	}{
+		// no retry policy
+		{retry: nil, codes: []int{1, 0}, runs: 1, exit: 1},
+		// succeeds on the second attempt
+		{retry: &engine.Retry{Attempts: 3}, codes: []int{1, 0}, runs: 2, exit: 0},
+		// fails all attempts
+		{retry: &engine.Retry{Attempts: 3}, codes: []int{1, 1, 1, 1}, runs: 3, exit: 1},
+		// exit code is not retried
+		{retry: &engine.Retry{Attempts: 3, ExitCodes: []int{2}}, codes: []int{1, 0}, runs: 1, exit: 1},
+		// exit code is retried
+		{retry: &engine.Retry{Attempts: 3, ExitCodes: []int{2}}, codes: []int{2, 1, 0}, runs: 2, exit: 1},
+		// exit code 78 is never retried
+		{retry: &engine.Retry{Attempts: 3}, codes: []int{78, 0}, runs: 1, exit: 78},
+	}
+	for i, test := range tests {
+		eng := &retryEngine{codes: test.codes}
+		e := &execer{engine: eng}
+		var buf bytes.Buffer
+		state, err := e.run(context.Background(), &engine.Spec{}, &engine.Step{Retry: test.retry}, &buf)
+		if err != nil {
+			t.Errorf("Want no error for test %d, got %s", i, err)
+			continue
+		}
+		if got, want := eng.runs, test.runs; got != want {
+			t.Errorf("Want %d runs for test %d, got %d", want, i, got)
+		}
+		if got, want := state.ExitCode, test.exit; got != want {
+			t.Errorf("Want exit code %d for test %d, got %d", want, i, got)
+		}
+		if got, want := strings.Count(buf.String(), "retrying in"), test.runs-1; got != want {
+			t.Errorf("Want %d separators for test %d, got %d", want, i, got)
+		}
+	}
+}
+
+func TestExec_RetryBackoff(t *testing.T) {
+	eng := &retryEngine{codes: []int{1, 1, 0}}
+	e := &execer{engine: eng}
+	var buf bytes.Buffer
+	step := &engine.Step{
+		Retry: &engine.Retry{Attempts: 3, Delay: time.Millisecond, Backoff: 2},
+	}
+	e.run(context.Background(), &engine.Spec{}, step, &buf)
+	if !strings.Contains(buf.String(), "retrying in 1ms") ||
+		!strings.Contains(buf.String(), "retrying in 2ms") {
+		t.Errorf("Want delay multiplied by the backoff factor, got %q", buf.String())
+	}
+}
+
+func TestExec_RetryCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	eng := &retryEngine{codes: []int{1, 0}}
+	e := &execer{engine: eng}
+	step := &engine.Step{
+		Retry: &engine.Retry{Attempts: 3, Delay: time.Hour},
+	}
+	_, err := e.run(ctx, &engine.Spec{}, step, io.Discard)
+	if err != context.Canceled {
+		t.Errorf("Want context cancelled, got %v", err)
+	}
+	if eng.runs != 1 {
+		t.Errorf("Want step not retried when cancelled, got %d runs", eng.runs)
+	}
+}
+
+func TestWillRetry(t *testing.T) {
+	step := &engine.Step{Retry: &engine.Retry{Attempts: 3}}
+	failed := &engine.State{ExitCode: 1, Exited: true}
+	if !WillRetry(step, 2, failed, nil) {
+		t.Errorf("Want step retried after the second attempt")
+	}
+	if WillRetry(step, 3, failed, nil) {
+		t.Errorf("Want step not retried after the last attempt")
+	}
+	if WillRetry(&engine.Step{}, 1, failed, nil) {
+		t.Errorf("Want step not retried without a retry policy")
+	}
+}
+
+// retryEngine is an engine that exits with the next exit code
+// each time a step is executed.
+type retryEngine struct {
+	engine.Engine
+	codes []int
+	runs  int
+}
+
+func (e *retryEngine) Run(ctx context.Context, spec *engine.Spec, step *engine.Step, w io.Writer) (*engine.State, error) {
+	code := e.codes[e.runs]
+	e.runs++
+	return &engine.State{ExitCode: code, Exited: true}, nil
+}
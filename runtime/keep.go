@@ -0,0 +1,32 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import "fmt"
+
+// Keep defines when the pipeline workspace is kept, instead of
+// removed, once the pipeline completes.
+type Keep int
+
+// Keep enumeration.
+const (
+	KeepNever Keep = iota
+	KeepOnFailure
+	KeepAlways
+)
+
+// ParseKeep parses the keep policy from a string.
+func ParseKeep(s string) (Keep, error) {
+	switch s {
+	case "", "never":
+		return KeepNever, nil
+	case "failure":
+		return KeepOnFailure, nil
+	case "always":
+		return KeepAlways, nil
+	default:
+		return KeepNever, fmt.Errorf("invalid keep policy: %s", s)
+	}
+}
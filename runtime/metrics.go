@@ -0,0 +1,55 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"time"
+
+	"github.com/drone/runner-go/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	stagesRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drone_runner_stages_running",
+		Help: "Number of pipeline stages executing.",
+	})
+	paused = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drone_runner_paused",
+		Help: "Whether the runner stopped requesting stages, for example, when the host is low on disk space.",
+	})
+	stepDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "drone_runner_step_duration_seconds",
+		Help:    "Duration of pipeline steps, by outcome.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"outcome"})
+	pollErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drone_runner_poll_errors_total",
+		Help: "Total number of errors requesting stages from the server.",
+	})
+	acceptConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drone_runner_accept_conflicts_total",
+		Help: "Total number of stages accepted by another runner.",
+	})
+	stepRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drone_runner_step_retries_total",
+		Help: "Total number of pipeline steps executed again by the retry policy.",
+	})
+	semaphoreWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "drone_runner_semaphore_wait_seconds",
+		Help:    "Time pipeline steps wait for the concurrency limit.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// helper function records the duration of the named step, by
+// the step outcome.
+func observeStep(state *pipeline.State, name string, started time.Time) {
+	state.Lock()
+	outcome := findStep(state, name).Status
+	state.Unlock()
+	stepDuration.WithLabelValues(outcome).Observe(time.Since(started).Seconds())
+}
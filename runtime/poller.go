@@ -9,6 +9,7 @@ package runtime
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/logger"
@@ -16,30 +17,77 @@ import (
 
 var noContext = context.Background()
 
+// interval at which a paused poller checks whether to resume
+// polling the server.
+var pauseInterval = 10 * time.Second
+
 // Poller polls the server for pending stages and dispatches
 // for execution by the Runner.
 type Poller struct {
 	Client client.Client
 	Filter *client.Filter
 	Runner *Runner
+
+	// Drain is closed to stop polling the server for pending
+	// stages. Running stages are not cancelled, and Poll
+	// returns when the running stages complete.
+	Drain <-chan struct{}
+
+	// Guard returns an error if the runner should not execute
+	// pending stages, for example, if the host is low on disk
+	// space. The poller is paused while the guard returns an
+	// error.
+	Guard func() error
+
+	mu     sync.Mutex
+	paused string
+}
+
+// reasoner is implemented by guard errors that include current
+// values, such as the free disk space, in the error message.
+// The reason is stable, and is used to log the error message
+// only when the reason the poller is paused changes.
+type reasoner interface {
+	Reason() string
 }
 
 // Poll opens N connections to the server to poll for pending
 // stages for execution. Pending stages are dispatched to a
-// Runner for execution.
+// Runner for execution. Running stages are cancelled when the
+// context is cancelled.
 func (p *Poller) Poll(ctx context.Context, n int) {
+	// the request context is cancelled when the poller is
+	// drained, which stops polling for pending stages without
+	// cancelling the running stages.
+	reqctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.Drain:
+			cancel()
+		case <-reqctx.Done():
+		}
+	}()
+
 	var wg sync.WaitGroup
 	for i := 0; i < n; i++ {
 		wg.Add(1)
 		go func(i int) {
 			for {
 				select {
-				case <-ctx.Done():
+				case <-reqctx.Done():
 					wg.Done()
 					return
 				default:
-					p.poll(ctx, i+1)
 				}
+				if p.pause(ctx) {
+					select {
+					case <-reqctx.Done():
+					case <-time.After(pauseInterval):
+					}
+					continue
+				}
+				p.poll(ctx, reqctx, i+1)
 			}
 		}(i)
 	}
@@ -47,20 +95,56 @@ func (p *Poller) Poll(ctx context.Context, n int) {
 	wg.Wait()
 }
 
+// pause returns true if the poller is paused. The reason the
+// poller is paused, or resumed, is logged once.
+func (p *Poller) pause(ctx context.Context) bool {
+	var err error
+	if p.Guard != nil {
+		err = p.Guard()
+	}
+	var reason string
+	if err != nil {
+		reason = err.Error()
+		if r, ok := err.(reasoner); ok {
+			reason = r.Reason()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reason == p.paused {
+		return reason != ""
+	}
+	p.paused = reason
+
+	log := logger.FromContext(ctx)
+	if reason != "" {
+		paused.Set(1)
+		log.WithError(err).
+			WithField("reason", reason).
+			Warnln("paused polling the remote server")
+		return true
+	}
+	paused.Set(0)
+	log.Infoln("resumed polling the remote server")
+	return false
+}
+
 // poll requests a stage for execution from the server, and then
 // dispatches for execution.
-func (p *Poller) poll(ctx context.Context, thread int) error {
+func (p *Poller) poll(ctx, reqctx context.Context, thread int) error {
 	log := logger.FromContext(ctx).WithField("thread", thread)
 	log.WithField("thread", thread).Debug("request stage from remote server")
 
 	// request a new build stage for execution from the central
 	// build server.
-	stage, err := p.Client.Request(ctx, p.Filter)
+	stage, err := p.Client.Request(reqctx, p.Filter)
 	if err == context.Canceled || err == context.DeadlineExceeded {
 		log.WithError(err).Trace("no stage returned")
 		return nil
 	}
 	if err != nil {
+		pollErrors.Inc()
 		log.WithError(err).Error("cannot request stage")
 		return err
 	}
@@ -72,5 +156,5 @@ func (p *Poller) poll(ctx context.Context, thread int) error {
 	}
 
 	return p.Runner.Run(
-		logger.WithContext(noContext, log), stage)
+		logger.WithContext(ctx, log), stage)
 }
@@ -7,7 +7,17 @@
 package runtime
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestPoll(t *testing.T) {
@@ -25,3 +35,123 @@ func TestPoll_EmptyStage(t *testing.T) {
 func TestPoll_RequestError(t *testing.T) {
 	t.Skip()
 }
+
+func TestPoll_Drain(t *testing.T) {
+	drain := make(chan struct{})
+	poller := &Poller{
+		Client: &blockingClient{},
+		Drain:  drain,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		poller.Poll(context.Background(), 2)
+		close(done)
+	}()
+
+	close(drain)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Want poller to stop polling when drained")
+	}
+}
+
+// blockingClient is a client that blocks when requesting a
+// stage until the context is cancelled.
+type blockingClient struct {
+	client.Client
+}
+
+func (c *blockingClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPoll_Paused(t *testing.T) {
+	pauseInterval = time.Millisecond
+	defer func() {
+		pauseInterval = 10 * time.Second
+	}()
+
+	drain := make(chan struct{})
+	client := &countingClient{}
+	poller := &Poller{
+		Client: client,
+		Drain:  drain,
+		Guard: func() error {
+			return errors.New("free disk space 1GiB is below 2GiB")
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		poller.Poll(context.Background(), 1)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(drain)
+	<-done
+
+	if client.count != 0 {
+		t.Errorf("Want no stages requested while paused, got %d requests", client.count)
+	}
+	if poller.paused == "" {
+		t.Errorf("Want the reason the poller is paused recorded")
+	}
+}
+
+// This test verifies the reason the poller is paused is logged
+// once, even if the guard error includes current values.
+func TestPoll_PausedReason(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	ctx := logger.WithContext(context.Background(), logger.Logrus(logrus.NewEntry(log)))
+
+	var free int
+	poller := &Poller{
+		Guard: func() error {
+			free++
+			return &reasonError{
+				reason: "low disk space",
+				msg:    fmt.Sprintf("free disk space %dGiB is below 10GiB", free),
+			}
+		},
+	}
+	for i := 0; i < 3; i++ {
+		if !poller.pause(ctx) {
+			t.Errorf("Want poller paused")
+		}
+	}
+	if got, want := len(hook.AllEntries()), 1; got != want {
+		t.Errorf("Want paused reason logged once, got %d entries", got)
+	}
+
+	poller.Guard = nil
+	if poller.pause(ctx) {
+		t.Errorf("Want poller resumed")
+	}
+	if got, want := len(hook.AllEntries()), 2; got != want {
+		t.Errorf("Want resumed logged once, got %d entries", got)
+	}
+}
+
+type reasonError struct {
+	reason string
+	msg    string
+}
+
+func (e *reasonError) Error() string  { return e.msg }
+func (e *reasonError) Reason() string { return e.reason }
+
+// countingClient is a client that counts the requests for
+// pending stages.
+type countingClient struct {
+	client.Client
+	count int
+}
+
+func (c *countingClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	c.count++
+	return nil, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+// default amount of time to wait for a detached step to
+// satisfy its readiness conditions.
+const readyTimeout = time.Minute
+
+// interval at which readiness conditions are evaluated.
+var readyInterval = time.Second
+
+var (
+	// errNotReady is returned when a detached step does not
+	// satisfy its readiness conditions before the timeout.
+	errNotReady = errors.New("detached step is not ready, timeout exceeded")
+
+	// errExited is returned when a detached step exits before
+	// satisfying its readiness conditions.
+	errExited = errors.New("detached step exited before it was ready")
+)
+
+// helper function blocks until the detached step satisfies its
+// readiness conditions, the step exits, or the readiness
+// timeout is exceeded.
+func waitReady(ctx context.Context, step *engine.Step, exited <-chan struct{}) error {
+	timeout := step.Ready.Timeout
+	if timeout <= 0 {
+		timeout = readyTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(readyInterval)
+	defer ticker.Stop()
+
+	for {
+		if isReady(step.Ready, step.WorkingDir) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return errExited
+		case <-timer.C:
+			return errNotReady
+		case <-ticker.C:
+		}
+	}
+}
+
+// helper function returns true if all readiness conditions
+// are satisfied. Relative file paths are resolved from the
+// step working directory.
+func isReady(ready *engine.Ready, dir string) bool {
+	if ready.TCP != "" {
+		conn, err := net.DialTimeout("tcp", ready.TCP, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+	}
+	if path := ready.File; path != "" {
+		if filepath.IsAbs(path) == false {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+func TestIsReady_TCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := l.Addr().String()
+
+	ready := &engine.Ready{TCP: addr}
+	if isReady(ready, "") == false {
+		t.Errorf("Want ready when port is listening")
+	}
+
+	l.Close()
+	if isReady(ready, "") == true {
+		t.Errorf("Want not ready when port is closed")
+	}
+}
+
+func TestIsReady_File(t *testing.T) {
+	dir := t.TempDir()
+
+	ready := &engine.Ready{File: "ready"}
+	if isReady(ready, dir) == true {
+		t.Errorf("Want not ready when file does not exist")
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "ready"), nil, 0600)
+	if isReady(ready, dir) == false {
+		t.Errorf("Want ready when relative file exists")
+	}
+
+	ready.File = filepath.Join(dir, "ready")
+	if isReady(ready, "") == false {
+		t.Errorf("Want ready when absolute file exists")
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	readyInterval = 10 * time.Millisecond
+	dir := t.TempDir()
+
+	step := &engine.Step{
+		WorkingDir: dir,
+		Ready:      &engine.Ready{File: "ready", Timeout: 5 * time.Second},
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(dir, "ready"), nil, 0600)
+	}()
+	if err := waitReady(noContext, step, nil); err != nil {
+		t.Errorf("Want ready, got error %s", err)
+	}
+}
+
+func TestWaitReady_Timeout(t *testing.T) {
+	readyInterval = 10 * time.Millisecond
+	step := &engine.Step{
+		WorkingDir: t.TempDir(),
+		Ready:      &engine.Ready{File: "ready", Timeout: 50 * time.Millisecond},
+	}
+	if err := waitReady(noContext, step, nil); err != errNotReady {
+		t.Errorf("Want not ready error, got %v", err)
+	}
+}
+
+func TestWaitReady_Exited(t *testing.T) {
+	readyInterval = 10 * time.Millisecond
+	step := &engine.Step{
+		WorkingDir: t.TempDir(),
+		Ready:      &engine.Ready{File: "ready"},
+	}
+	exited := make(chan struct{})
+	close(exited)
+	if err := waitReady(noContext, step, exited); err != errExited {
+		t.Errorf("Want exited error, got %v", err)
+	}
+}
+
+func TestWaitReady_Cancel(t *testing.T) {
+	readyInterval = 10 * time.Millisecond
+	step := &engine.Step{
+		WorkingDir: t.TempDir(),
+		Ready:      &engine.Ready{File: "ready"},
+	}
+	ctx, cancel := context.WithCancel(noContext)
+	cancel()
+	if err := waitReady(ctx, step, nil); err != context.Canceled {
+		t.Errorf("Want context cancelled error, got %v", err)
+	}
+}
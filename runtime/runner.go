@@ -65,6 +65,32 @@ type Runner struct {
 	// Symlinks provides an optional list of symlinks that are
 	// created and linked to the pipeline workspace.
 	Symlinks map[string]string
+
+	// User defines the optional operating system user used to
+	// execute the pipeline steps.
+	User string
+
+	// Group defines the optional operating system group used
+	// to execute the pipeline steps.
+	Group string
+
+	// Limits defines the default resource limits applied to
+	// each pipeline step.
+	Limits engine.Limits
+
+	// Sandbox is an optional function that returns true if the
+	// pipeline should execute in the sandbox, with read-only
+	// access to the host filesystem.
+	Sandbox func(*drone.Repo, *drone.Build) bool
+
+	// SecretFiles configures the pipeline steps to receive
+	// masked secrets as files, instead of environment variables.
+	SecretFiles bool
+
+	// Guard is an optional function that returns an error if
+	// the runner should not accept the stage, for example, if
+	// the host is low on disk space.
+	Guard func() error
 }
 
 // Run runs the pipeline stage.
@@ -80,8 +106,22 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 	// we need confirm receipt. The first agent that confirms
 	// receipt of the stage can assume ownership.
 
+	// the host is checked immediately before the stage is
+	// accepted, since the host may have run low on disk space
+	// after the stage was requested. A stage that is not
+	// accepted remains available to other runners.
+	if s.Guard != nil {
+		if err := s.Guard(); err != nil {
+			log.WithError(err).Warn("cannot accept stage, runner paused")
+			return err
+		}
+	}
+
 	stage.Machine = s.Machine
 	err := s.Client.Accept(ctx, stage)
+	if err == client.ErrOptimisticLock {
+		acceptConflicts.Inc()
+	}
 	if err != nil {
 		log.WithError(err).Error("cannot accept stage")
 		return err
@@ -188,6 +228,14 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 		return s.Reporter.ReportStage(noContext, state)
 	}
 
+	// only trusted repositories can override the operating
+	// system user used to execute the pipeline steps.
+	if resource.User != "" && data.Repo.Trusted == false {
+		log.Error("cannot process stage, pipeline user requires a trusted repository")
+		state.FailAll(errors.New("insufficient privileges to define the pipeline user"))
+		return s.Reporter.ReportStage(noContext, state)
+	}
+
 	secrets := secret.Combine(
 		secret.Static(data.Secrets),
 		secret.Encrypted(),
@@ -197,20 +245,30 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 	// compile the yaml configuration file to an intermediate
 	// representation, and then
 	comp := &compiler.Compiler{
-		Pipeline: resource,
-		Manifest: manifest,
-		Environ:  s.Environ,
-		Build:    data.Build,
-		Stage:    stage,
-		Repo:     data.Repo,
-		System:   data.System,
-		Netrc:    data.Netrc,
-		Secret:   secrets,
-		Root:     s.Root,
-		Symlinks: s.Symlinks,
-	}
-
-	spec := comp.Compile(ctx)
+		Pipeline:    resource,
+		Manifest:    manifest,
+		Environ:     s.Environ,
+		Build:       data.Build,
+		Stage:       stage,
+		Repo:        data.Repo,
+		System:      data.System,
+		Netrc:       data.Netrc,
+		Secret:      secrets,
+		Root:        s.Root,
+		Symlinks:    s.Symlinks,
+		User:        s.User,
+		Group:       s.Group,
+		Limits:      s.Limits,
+		Sandbox:     s.Sandbox != nil && s.Sandbox(data.Repo, data.Build),
+		SecretFiles: s.SecretFiles,
+	}
+
+	spec, err := comp.Compile(ctx)
+	if err != nil {
+		log.WithError(err).Error("cannot compile pipeline")
+		state.FailAll(err)
+		return s.Reporter.ReportStage(noContext, state)
+	}
 	for _, src := range spec.Steps {
 		// steps that are skipped are ignored and are not stored
 		// in the drone database, nor displayed in the UI.
@@ -235,6 +293,9 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 
 	log.Debug("updated stage to running")
 
+	stagesRunning.Inc()
+	defer stagesRunning.Dec()
+
 	ctxcancel = logger.WithContext(ctxcancel, log)
 	err = s.Execer.Exec(ctxcancel, spec, state)
 	if err != nil {